@@ -22,33 +22,181 @@ type ModpackConfig struct {
 }
 
 type InstallConfig struct {
-	MCVersion          string                 `yaml:"mcVersion"`
-	LoaderVersion      string                 `yaml:"loaderVersion"`
-	InstallerUrl       string                 `yaml:"installerUrl"`
-	InstallerArguments []string               `yaml:"installerArguments"`
-	ModpackUrl         string                 `yaml:"modpackUrl"`
-	ModpackFormat      string                 `yaml:"modpackFormat"`
-	FormatSpecific     FormatSpecificConfig   `yaml:"formatSpecific"`
-	BaseInstallPath    string                 `yaml:"baseInstallPath"`
-	IgnoreFiles        []string               `yaml:"ignoreFiles"`
-	AdditionalFiles    []AdditionalFileConfig `yaml:"additionalFiles"`
-	LocalFiles         []LocalFileConfig      `yaml:"localFiles"`
-	CheckFolder        bool                   `yaml:"checkFolder"`
-	InstallLoader      bool                   `yaml:"installLoader"`
+	MCVersion          string               `yaml:"mcVersion"`
+	LoaderVersion      string               `yaml:"loaderVersion"`
+	InstallerUrl       string               `yaml:"installerUrl"`
+	InstallerArguments []string             `yaml:"installerArguments"`
+	ModpackUrl         string               `yaml:"modpackUrl"`
+	ModpackFormat      string               `yaml:"modpackFormat"`
+	FormatSpecific     FormatSpecificConfig `yaml:"formatSpecific"`
+	BaseInstallPath    string               `yaml:"baseInstallPath"`
+	// Files the install skips, as globs on the path in the install like
+	// mods/optifine*.jar or regular expressions starting with re:. Both
+	// match the whole path. Rules under mods/ used to be regular
+	// expressions on the file name, such old rules need a re: prefix now.
+	IgnoreFiles     []string               `yaml:"ignoreFiles"`
+	AdditionalFiles []AdditionalFileConfig `yaml:"additionalFiles"`
+	LocalFiles      []LocalFileConfig      `yaml:"localFiles"`
+	CheckFolder     bool                   `yaml:"checkFolder"`
+	InstallLoader   bool                   `yaml:"installLoader"`
+	Backup          BackupConfig           `yaml:"backup"`
+	Rcon            RconConfig             `yaml:"rcon"`
+}
+
+type RconConfig struct {
+	// Enable rcon in server.properties at install time
+	Configure bool `yaml:"configure"`
+	// Port and password to set, a random password is generated if empty
+	Port     int    `yaml:"port"`
+	Password string `yaml:"password"`
+}
+
+type BackupConfig struct {
+	// Directory the backups are stored in, relative to baseInstallPath
+	Path string `yaml:"path"`
+	// Number of backups to keep, 0 keeps all
+	Keep     int      `yaml:"keep"`
+	Compress bool     `yaml:"compress"`
+	Paths    []string `yaml:"paths"`
 }
 
 type LaunchConfig struct {
-	Spongefix      bool     `yaml:"spongefix"`
-	RamDisk        bool     `yaml:"ramDisk"`
-	CheckOffline   bool     `yaml:"checkOffline"`
-	MaxRam         string   `yaml:"maxRam"`
-	AutoRestart    bool     `yaml:"autoRestart"`
-	CrashLimit     int      `yaml:"crashLimit"`
+	Spongefix bool `yaml:"spongefix"`
+	// Accept the Minecraft EULA without asking
+	AcceptEula bool `yaml:"acceptEula"`
+	// Keep the world on a tmpfs and sync it back to disk periodically,
+	// Linux only
+	RamDisk bool `yaml:"ramDisk"`
+	// Directory on a tmpfs the world is copied to
+	RamDiskPath         string `yaml:"ramDiskPath"`
+	RamDiskSyncInterval string `yaml:"ramDiskSyncInterval"`
+	CheckOffline        bool   `yaml:"checkOffline"`
+	MaxRam              string `yaml:"maxRam"`
+	AutoRestart         bool   `yaml:"autoRestart"`
+	// Crashes in a row before the restart policy gives up, 0 never gives up.
+	// With the quarantine it has to be larger than quarantine.crashes.
+	CrashLimit int `yaml:"crashLimit"`
+	// No longer used, restart.stableUptime resets the crash count
 	CrashTimer     string   `yaml:"crashTimer"`
 	PreJavaArgs    string   `yaml:"preJavaArgs"`
 	StartFile      string   `yaml:"startFile"`
 	ForcedJavaPath string   `yaml:"forcedJavaPath"`
 	JavaArgs       []string `yaml:"javaArgs"`
+	// Named set of JVM flags added before javaArgs: aikar, zgc, shenandoah
+	// or minimal
+	JavaPreset string `yaml:"javaPreset"`
+	// How long to wait for the server to stop after the stop command,
+	// before it gets SIGTERM and after that SIGKILL
+	ShutdownTimeout string `yaml:"shutdownTimeout"`
+	KillTimeout     string `yaml:"killTimeout"`
+	// Unix socket the attach command connects to, relative to
+	// baseInstallPath. Empty disables it.
+	ConsoleSocket string `yaml:"consoleSocket"`
+	// The server counts as crashed if it does not print a ready line
+	// within this time. Off by default, large packs can take long on their
+	// first start and not every server prints the usual ready line.
+	ReadyTimeout string `yaml:"readyTimeout"`
+	// Additional regular expressions for ready lines
+	ReadyPatterns []string          `yaml:"readyPatterns"`
+	Watchdog      WatchdogConfig    `yaml:"watchdog"`
+	Restart       RestartConfig     `yaml:"restart"`
+	Quarantine    QuarantineConfig  `yaml:"quarantine"`
+	ManagedJava   ManagedJavaConfig `yaml:"managedJava"`
+	// Merged into server.properties before every start, values may use
+	// $VAR, ${VAR} and ${VAR:-default}
+	ServerProperties map[string]string `yaml:"serverProperties"`
+	Players          PlayersConfig     `yaml:"players"`
+	// Tasks run against the running server at the times of cron expressions
+	Schedule []ScheduleConfig `yaml:"schedule"`
+}
+
+type ScheduleConfig struct {
+	// Five fields like "0 4 * * *", or @hourly, @daily, @weekly...
+	Cron string `yaml:"cron"`
+	// command, broadcast, restart or backup
+	Action string `yaml:"action"`
+	// Console command of the command action
+	Command string `yaml:"command"`
+	// Text of the broadcast, for restarts the warning with {{@time@}}
+	// replaced by the time left
+	Message string `yaml:"message"`
+	// Players are warned this long before a restart, like 10m, 1m, 10s
+	Warnings []string `yaml:"warnings"`
+	// Directory the world backups are stored in, relative to
+	// baseInstallPath
+	Path string `yaml:"path"`
+	// Number of world backups to keep, 0 keeps all
+	Keep int `yaml:"keep"`
+}
+
+// Operators, whitelist and bans written to the server's json files before
+// the start. Names are resolved to UUIDs.
+type PlayersConfig struct {
+	// merge keeps entries added in game, replace only keeps the configured
+	Policy    string      `yaml:"policy"`
+	Ops       []OpConfig  `yaml:"ops"`
+	Whitelist []string    `yaml:"whitelist"`
+	Bans      []BanConfig `yaml:"bans"`
+}
+
+type OpConfig struct {
+	Name                string `yaml:"name"`
+	Level               int    `yaml:"level"`
+	BypassesPlayerLimit bool   `yaml:"bypassesPlayerLimit"`
+}
+
+type BanConfig struct {
+	Name   string `yaml:"name"`
+	Reason string `yaml:"reason"`
+}
+
+// Download the Java runtime for the pack instead of using one of the host
+type ManagedJavaConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Runtimes are shared by all instances using this directory
+	RuntimesPath string `yaml:"runtimesPath"`
+	// jre or jdk, only used with the Adoptium API
+	ImageType string `yaml:"imageType"`
+	// Download from here instead of the Adoptium API. {{@javaversion@}},
+	// {{@os@}} and {{@arch@}} are replaced.
+	UrlTemplate string `yaml:"urlTemplate"`
+	// SHA-256 of the download, defaults to the url with .sha256.txt
+	ChecksumUrlTemplate string `yaml:"checksumUrlTemplate"`
+}
+
+// Mods blamed by the crash reports of several startup crashes in a row are
+// moved out of the mods folder
+type QuarantineConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Startup crashes in a row blaming the same mod
+	Crashes int `yaml:"crashes"`
+	// Directory the mods are moved to, relative to baseInstallPath
+	Path string `yaml:"path"`
+}
+
+// Delay between restarts after crashes, it grows with every crash in a row
+type RestartConfig struct {
+	InitialDelay string  `yaml:"initialDelay"`
+	Multiplier   float64 `yaml:"multiplier"`
+	MaxDelay     string  `yaml:"maxDelay"`
+	// A run lasting this long resets the delay and the crash count
+	StableUptime string `yaml:"stableUptime"`
+	// What to do when crashLimit is reached: exit, stop or hook. With stop
+	// the starter keeps running without a server until it gets a signal,
+	// so supervisors do not start it again.
+	GiveUp string `yaml:"giveUp"`
+	// Shell command run by the hook action
+	Hook string `yaml:"hook"`
+}
+
+// The watchdog pings the server and restarts it when it stops answering
+type WatchdogConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Defaults to server-ip and server-port from server.properties
+	Address     string `yaml:"address"`
+	Interval    string `yaml:"interval"`
+	Timeout     string `yaml:"timeout"`
+	MaxFailures int    `yaml:"maxFailures"`
 }
 
 type AdditionalFileConfig struct {
@@ -65,9 +213,37 @@ type FormatSpecificConfig struct {
 	IgnoreProject []int `yaml:"ignoreProject"`
 }
 
+// Values used for settings missing in the config file
+func defaultConfig() *ConfigFile {
+	c := &ConfigFile{}
+	c.Install.Backup.Path = "backups"
+	c.Install.Backup.Keep = 5
+	c.Install.Backup.Paths = []string{"mods", "config", "kubejs"}
+	c.Launch.RamDiskPath = "/dev/shm"
+	c.Launch.RamDiskSyncInterval = "15m"
+	c.Launch.ShutdownTimeout = "60s"
+	c.Launch.KillTimeout = "10s"
+	c.Launch.ConsoleSocket = "serverstarter.sock"
+	c.Launch.ReadyTimeout = "0"
+	c.Launch.Watchdog.Interval = "30s"
+	c.Launch.Watchdog.Timeout = "10s"
+	c.Launch.Watchdog.MaxFailures = 3
+	c.Launch.Restart.InitialDelay = "10s"
+	c.Launch.Restart.Multiplier = 2
+	c.Launch.Restart.MaxDelay = "5m"
+	c.Launch.Restart.StableUptime = "10m"
+	c.Launch.Restart.GiveUp = "exit"
+	c.Launch.Quarantine.Crashes = 3
+	c.Launch.Quarantine.Path = "mods-quarantine"
+	c.Launch.ManagedJava.ImageType = "jre"
+	c.Launch.Players.Policy = "merge"
+
+	return c
+}
+
 func Read(path string) *ConfigFile {
 
-	c := &ConfigFile{}
+	c := defaultConfig()
 
 	yamlFile, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -0,0 +1,213 @@
+package console
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrNotRunning = errors.New("server is not running")
+var ErrTimeout = errors.New("timed out waiting for server output")
+
+// Size of the channel buffer of every subscriber, lines are dropped for
+// subscribers that do not keep up
+const subscriberBuffer = 256
+
+// Number of output lines kept for clients attaching later
+const scrollbackLines = 500
+
+// Console sits between the terminal and the server process. It forwards
+// operator input, tees the server output to the terminal and to
+// subscribers, and lets the starter itself send commands.
+// A console outlives server restarts, every new process gets attached to it.
+type Console struct {
+	output io.Writer
+
+	mutex       sync.Mutex
+	stdin       io.Writer
+	detached    chan struct{}
+	subscribers map[int]chan string
+	nextID      int
+	scrollback  []string
+}
+
+func New(output io.Writer) *Console {
+	c := Console{}
+	c.output = output
+	c.subscribers = map[int]chan string{}
+
+	return &c
+}
+
+// Attach connects the stdin of a started server
+func (c *Console) Attach(stdin io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stdin = stdin
+	c.detached = make(chan struct{})
+}
+
+// Detach disconnects the server once it exited
+func (c *Console) Detach() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stdin = nil
+	if c.detached != nil {
+		close(c.detached)
+		c.detached = nil
+	}
+}
+
+// Running reports if a server is attached
+func (c *Console) Running() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.stdin != nil
+}
+
+// Pump reads the server output until r is closed
+func (c *Console) Pump(r io.Reader) {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			io.WriteString(c.output, line)
+			c.publish(strings.TrimRight(line, "\r\n"))
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Error(err)
+			}
+			return
+		}
+	}
+}
+
+func (c *Console) publish(line string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.scrollback = append(c.scrollback, line)
+	if len(c.scrollback) > scrollbackLines {
+		c.scrollback = c.scrollback[len(c.scrollback)-scrollbackLines:]
+	}
+
+	for _, ch := range c.subscribers {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every output line of the server.
+// The returned function ends the subscription.
+func (c *Console) Subscribe() (<-chan string, func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.subscribe()
+}
+
+// Follow is Subscribe, but also returns the recent output. No line is
+// missed or repeated between the two.
+func (c *Console) Follow() ([]string, <-chan string, func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	history := make([]string, len(c.scrollback))
+	copy(history, c.scrollback)
+	lines, unsubscribe := c.subscribe()
+	return history, lines, unsubscribe
+}
+
+// subscribe expects the mutex to be held
+func (c *Console) subscribe() (<-chan string, func()) {
+	id := c.nextID
+	c.nextID++
+	ch := make(chan string, subscriberBuffer)
+	c.subscribers[id] = ch
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+			delete(c.subscribers, id)
+			close(ch)
+		})
+	}
+}
+
+// Send writes a command to the server console
+func (c *Console) Send(command string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stdin == nil {
+		return ErrNotRunning
+	}
+
+	log.Debugf("Sending command to server: %s", command)
+	_, err := fmt.Fprintln(c.stdin, command)
+	return err
+}
+
+// Await waits for an output line accepted by match
+func (c *Console) Await(match func(line string) bool, timeout time.Duration) (string, error) {
+	return c.SendAndAwait("", match, timeout)
+}
+
+// SendAndAwait sends a command and waits for the first output line accepted
+// by match. An empty command only waits. Waiting ends early if the server
+// exits.
+func (c *Console) SendAndAwait(command string, match func(line string) bool, timeout time.Duration) (string, error) {
+	c.mutex.Lock()
+	lines, unsubscribe := c.subscribe()
+	detached := c.detached
+	c.mutex.Unlock()
+	defer unsubscribe()
+
+	if command != "" {
+		err := c.Send(command)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case line := <-lines:
+			if match(line) {
+				return line, nil
+			}
+		case <-detached:
+			return "", ErrNotRunning
+		case <-timer.C:
+			return "", ErrTimeout
+		}
+	}
+}
+
+// ForwardInput sends every line read from r to the server, it is meant for
+// the operator's terminal
+func (c *Console) ForwardInput(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		err := c.Send(scanner.Text())
+		if err == ErrNotRunning {
+			log.Warn("Server is not running, input ignored")
+		} else if err != nil {
+			log.Error(err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package console
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Serve exposes the console on a unix socket, clients get the scrollback,
+// the live output and can send commands
+func (c *Console) Serve(path string) (io.Closer, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("console socket %s is in use by another instance", path)
+	}
+	// Left over from an instance that did not shut down cleanly
+	os.Remove(path)
+
+	listener, err := listenPrivate(path)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Console is available on %s", path)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go c.serveConn(conn)
+		}
+	}()
+
+	return listener, nil
+}
+
+// listenPrivate creates the socket in a directory only the starter can
+// enter and moves it into place once its permissions are set. Listening on
+// path directly would leave it open to everyone until the chmod.
+func listenPrivate(path string) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".serverstarter-sock-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmpPath := filepath.Join(dir, filepath.Base(path))
+	listener, err := net.Listen("unix", tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	// The socket is removed by the caller under its final name
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	err = os.Chmod(tmpPath, 0660)
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func (c *Console) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	log.Info("Console client attached")
+	defer log.Info("Console client detached")
+
+	var writeMutex sync.Mutex
+	writeLine := func(line string) error {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		_, err := fmt.Fprintln(conn, line)
+		return err
+	}
+
+	history, lines, unsubscribe := c.Follow()
+	defer unsubscribe()
+
+	go func() {
+		for _, line := range history {
+			if writeLine(line) != nil {
+				conn.Close()
+				return
+			}
+		}
+		for line := range lines {
+			if writeLine(line) != nil {
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		err := c.Send(scanner.Text())
+		if err == ErrNotRunning {
+			writeLine("[serverstarter] Server is not running, input ignored")
+		} else if err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// Connect attaches to the console socket of a running instance. Lines read
+// from in are sent as commands, the server output is written to out.
+// It returns when in is closed or the instance goes away.
+func Connect(path string, in io.Reader, out io.Writer) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	go func() {
+		io.Copy(conn, in)
+		if unixConn, ok := conn.(*net.UnixConn); ok {
+			unixConn.CloseWrite()
+		}
+	}()
+
+	_, err = io.Copy(out, conn)
+	return err
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Strange-Account/go-mc-server-starter/utils"
+)
+
+// Crash bundles are written here, relative to the base path
+const crashBundleDirName = "crash-bundles"
+
+// crashReport is a crash report or JVM error log written during a server run
+type crashReport struct {
+	path          string
+	description   string
+	exception     string
+	suspectedMods []string
+	bundle        string
+}
+
+// findCrashReport returns the newest crash report or JVM error log written
+// since the server started, or nil if there is none
+func (l *loaderManager) findCrashReport(since time.Time) *crashReport {
+	candidates, _ := filepath.Glob(filepath.Join(l.basePath, "crash-reports", "*.txt"))
+	errorLogs, _ := filepath.Glob(filepath.Join(l.basePath, "hs_err_pid*.log"))
+	candidates = append(candidates, errorLogs...)
+
+	newest := ""
+	var newestTime time.Time
+	for _, path := range candidates {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		// Reports from earlier runs are not about this crash
+		if info.ModTime().Before(since) {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestTime) {
+			newest = path
+			newestTime = info.ModTime()
+		}
+	}
+	if newest == "" {
+		return nil
+	}
+
+	report, err := parseCrashReport(newest)
+	if err != nil {
+		log.Errorf("Could not read crash report %s: %v", newest, err)
+		return &crashReport{path: newest}
+	}
+	return report
+}
+
+// parseCrashReport extracts the exception and suspected mods of a Minecraft
+// crash report, or the error of a JVM error log
+func parseCrashReport(path string) (*crashReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	report := crashReport{path: path}
+	isErrorLog := strings.HasPrefix(filepath.Base(path), "hs_err_pid")
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	inDescription := false
+	inSuspects := false
+	suspectsIndent := 0
+	inFatalError := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if isErrorLog {
+			// # A fatal error has been detected by the Java Runtime Environment:
+			// #
+			// #  SIGSEGV (0xb) at pc=...
+			text := strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+			switch {
+			case report.description == "" && strings.HasPrefix(trimmed, "#") && text != "":
+				report.description = text
+				inFatalError = true
+			case inFatalError && text == "":
+				continue
+			case inFatalError:
+				report.exception = text
+				inFatalError = false
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "Description:"):
+			report.description = strings.TrimSpace(strings.TrimPrefix(line, "Description:"))
+			inDescription = true
+			continue
+		case inDescription && trimmed == "":
+			continue
+		case inDescription:
+			// The first line after the description is the exception
+			report.exception = trimmed
+			inDescription = false
+			continue
+		}
+
+		// Suspected Mods:
+		// 	Name (modid), Version: 1.0
+		// 		Issue tracker URL: ...
+		indent := len(line) - len(strings.TrimLeft(line, "\t "))
+		if strings.HasPrefix(trimmed, "Suspected Mod") {
+			inSuspects = true
+			suspectsIndent = indent
+			if i := strings.Index(trimmed, ":"); i >= 0 {
+				first := strings.TrimSpace(trimmed[i+1:])
+				if first != "" && !strings.EqualFold(first, "NONE") {
+					report.suspectedMods = append(report.suspectedMods, first)
+				}
+			}
+			continue
+		}
+		if inSuspects {
+			if trimmed == "" || indent <= suspectsIndent {
+				inSuspects = false
+				continue
+			}
+			// Mods are indented once more than the heading, their details further
+			if indent == suspectsIndent+1 {
+				report.suspectedMods = append(report.suspectedMods, trimmed)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// bundleCrash archives the crash report and the latest log into a
+// timestamped zip in the crash bundle directory
+func (l *loaderManager) bundleCrash(exit serverExit, report *crashReport) (string, error) {
+	bundleDir := filepath.Join(l.basePath, crashBundleDirName)
+	name := "crash-" + time.Now().Format("2006-01-02_15-04-05")
+	// Crashes within the same second get numbered bundles
+	for i := 2; ; i++ {
+		_, err := os.Stat(filepath.Join(bundleDir, name+".zip"))
+		if os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("crash-%s-%d", time.Now().Format("2006-01-02_15-04-05"), i)
+	}
+
+	stagingPath := filepath.Join(bundleDir, name)
+	err := os.MkdirAll(stagingPath, 0755)
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(stagingPath)
+
+	if report != nil {
+		err = utils.CopyFile(report.path, filepath.Join(stagingPath, filepath.Base(report.path)))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	latestLog := filepath.Join(l.basePath, "logs", "latest.log")
+	if _, err := os.Stat(latestLog); err == nil {
+		err = utils.CopyFile(latestLog, filepath.Join(stagingPath, "latest.log"))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	summary := exit.String() + "\n"
+	if report != nil {
+		summary += report.summary()
+	}
+	err = ioutil.WriteFile(filepath.Join(stagingPath, "summary.txt"), []byte(summary), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	bundlePath := filepath.Join(bundleDir, name+".zip")
+	err = utils.Zip(stagingPath, bundlePath)
+	if err != nil {
+		os.Remove(bundlePath)
+		return "", err
+	}
+
+	return bundlePath, nil
+}
+
+// collectCrash finds the report of a crashed run and archives it
+func (l *loaderManager) collectCrash(server *serverProcess, exit serverExit) *crashReport {
+	report := l.findCrashReport(server.startTime)
+
+	bundle, err := l.bundleCrash(exit, report)
+	if err != nil {
+		log.Errorf("Could not create crash bundle: %v", err)
+		return report
+	}
+	if report == nil {
+		report = &crashReport{}
+	}
+	report.bundle = bundle
+
+	return report
+}
+
+func (r *crashReport) summary() string {
+	var b strings.Builder
+	if r.path != "" {
+		fmt.Fprintf(&b, "Report: %s\n", r.path)
+	}
+	if r.description != "" {
+		fmt.Fprintf(&b, "Description: %s\n", r.description)
+	}
+	if r.exception != "" {
+		fmt.Fprintf(&b, "Exception: %s\n", r.exception)
+	}
+	if len(r.suspectedMods) > 0 {
+		fmt.Fprintf(&b, "Suspected mods: %s\n", strings.Join(r.suspectedMods, "; "))
+	}
+	return b.String()
+}
+
+func (r *crashReport) printSummary() {
+	if r.path == "" {
+		log.Warn("The server did not write a crash report")
+	}
+	for _, line := range strings.Split(strings.TrimSpace(r.summary()), "\n") {
+		if line != "" {
+			log.Error(line)
+		}
+	}
+	if r.bundle != "" {
+		log.Infof("Crash bundle written to %s", r.bundle)
+	}
+}
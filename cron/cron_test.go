@@ -0,0 +1,77 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"x * * * *",
+		"* * * foo *",
+		"1,,2 * * * *",
+		"@reboot",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		expr string
+		from string
+		next []string
+	}{
+		{"*/15 * * * *", "2026-10-19 03:58:30", []string{"2026-10-19 04:00", "2026-10-19 04:15", "2026-10-19 04:30"}},
+		// Exactly on a match the next one is returned
+		{"0 4 * * *", "2026-10-19 04:00:00", []string{"2026-10-20 04:00"}},
+		{"0 4 * * mon-fri", "2026-10-23 05:00:00", []string{"2026-10-26 04:00", "2026-10-27 04:00"}},
+		{"@weekly", "2026-10-19 12:00:00", []string{"2026-10-25 00:00", "2026-11-01 00:00"}},
+		{"0 4 * * 7", "2026-10-19 12:00:00", []string{"2026-10-25 04:00"}},
+		// Month ends
+		{"0 0 1 * *", "2026-12-31 23:59:00", []string{"2027-01-01 00:00", "2027-02-01 00:00"}},
+		{"0 12 31 * *", "2026-01-31 13:00:00", []string{"2026-03-31 12:00", "2026-05-31 12:00"}},
+		{"59 23 * * *", "2026-02-28 23:59:00", []string{"2026-03-01 23:59"}},
+		// Feb 29 only exists in leap years
+		{"30 2 29 feb *", "2026-10-19 00:00:00", []string{"2028-02-29 02:30", "2032-02-29 02:30"}},
+		{"5/20 1-2 * * *", "2026-10-19 00:00:00", []string{"2026-10-19 01:05", "2026-10-19 01:25", "2026-10-19 01:45", "2026-10-19 02:05"}},
+		// Day of month or day of week when both are restricted
+		{"0 0 13 * fri", "2026-10-19 00:00:00", []string{"2026-10-23 00:00", "2026-10-30 00:00", "2026-11-06 00:00", "2026-11-13 00:00"}},
+		// A step on * still counts as unrestricted, so both have to match
+		{"0 0 */2 * mon", "2026-10-19 00:00:00", []string{"2026-11-09 00:00", "2026-11-23 00:00"}},
+		{"0 0 1 * */1", "2026-10-19 00:00:00", []string{"2026-11-01 00:00", "2026-12-01 00:00"}},
+	}
+
+	for _, test := range tests {
+		s, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%q: %v", test.expr, err)
+			continue
+		}
+		from, err := time.Parse("2006-01-02 15:04:05", test.from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next := from
+		for _, want := range test.next {
+			next = s.Next(next)
+			if got := next.Format("2006-01-02 15:04"); got != want {
+				t.Errorf("%q after %s: got %s, want %s", test.expr, test.from, got, want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Strange-Account/go-mc-server-starter/utils"
+)
+
+const eulaUrl = "https://aka.ms/MinecraftEULA"
+
+// The format of Java's Date.toString, used by the server for the timestamp
+// in eula.txt
+const eulaTimeFormat = "Mon Jan 02 15:04:05 MST 2006"
+
+// checkEULA makes sure the EULA is accepted in eula.txt. It can be accepted
+// with EULA=true, --accept-eula, launch.acceptEula or by typing TRUE when
+// the starter runs in a terminal.
+func (l *loaderManager) checkEULA() error {
+	eulaFile := filepath.Join(l.basePath, "eula.txt")
+	properties, err := utils.ReadProperties(eulaFile)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(strings.TrimSpace(properties.GetDefault("eula", "false")), "true") {
+		return nil
+	}
+
+	switch {
+	case strings.EqualFold(strings.TrimSpace(os.Getenv("EULA")), "true"):
+		log.Info("EULA accepted through the EULA environment variable")
+	case l.acceptEula:
+		log.Info("EULA accepted with --accept-eula")
+	case l.launchConfig.AcceptEula:
+		log.Info("EULA accepted in the config (launch.acceptEula)")
+	case isTerminal(os.Stdin):
+		log.Info("You have not accepted the eula yet.")
+		log.Info("By typing TRUE you are indicating your agreement to the EULA of Mojang.")
+		log.Infof("Read it at %s before accepting it.", eulaUrl)
+		answer, err := readLine(os.Stdin)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if !strings.EqualFold(strings.TrimSpace(answer), "true") {
+			return errors.New("the EULA was not accepted")
+		}
+		log.Info("You have accepted the EULA.")
+	default:
+		// Leave a file for the operator to edit
+		if _, ok := properties.Get("eula"); !ok {
+			writeEula(eulaFile, properties, false)
+		}
+		return errors.New("the EULA is not accepted and there is no terminal to ask. " +
+			"Read it at " + eulaUrl + " and accept it by setting EULA=true, passing --accept-eula, " +
+			"setting launch.acceptEula in the config or setting eula=true in " + eulaFile)
+	}
+
+	return writeEula(eulaFile, properties, true)
+}
+
+func writeEula(eulaFile string, properties *utils.Properties, accepted bool) error {
+	if len(properties.Keys()) == 0 {
+		properties.AddComment("By changing the setting below to TRUE you are indicating your agreement to our EULA (" + eulaUrl + ").")
+		properties.AddComment(time.Now().Format(eulaTimeFormat))
+	}
+	if accepted {
+		properties.Set("eula", "true")
+	} else {
+		properties.Set("eula", "false")
+	}
+	return properties.Write(eulaFile)
+}
+
+// readLine reads a single line without buffering ahead, so the rest of the
+// input is left for the server console
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, b[0])
+		}
+		if err != nil {
+			return string(line), err
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+type exitKind int
+
+const (
+	exitStopped exitKind = iota
+	exitCrashed
+	exitKilled
+	exitOutOfMemory
+)
+
+func (k exitKind) String() string {
+	switch k {
+	case exitStopped:
+		return "clean stop"
+	case exitCrashed:
+		return "crash"
+	case exitKilled:
+		return "killed by signal"
+	case exitOutOfMemory:
+		return "out of memory"
+	}
+	return "unknown"
+}
+
+// serverExit describes how a server run ended
+type serverExit struct {
+	kind   exitKind
+	code   int
+	reason string
+	uptime time.Duration
+	ready  bool
+	// Crash report and bundle of a crashed run, if any
+	report *crashReport
+}
+
+// Everything but a clean stop counts against the crash limit
+func (e serverExit) isCrash() bool {
+	return e.kind != exitStopped
+}
+
+func (e serverExit) String() string {
+	return fmt.Sprintf("%s: %s after %s", e.kind, e.reason, e.uptime.Round(time.Second))
+}
+
+// classifyExit decides why the server exited from its exit status, what the
+// starter did to it and what it printed
+func classifyExit(server *serverProcess, err error) serverExit {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	exit := serverExit{}
+	exit.uptime = time.Since(server.startTime)
+	exit.ready = !server.readyTime.IsZero()
+
+	var signaled syscall.Signal
+	isSignaled := false
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			exit.kind = exitCrashed
+			exit.code = -1
+			exit.reason = err.Error()
+			return exit
+		}
+		exit.code = exitErr.ExitCode()
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			signaled = status.Signal()
+			isSignaled = true
+		}
+	}
+
+	switch {
+	case server.readyTimedOut:
+		exit.kind = exitCrashed
+		exit.reason = "server did not become ready in time"
+	case server.hung:
+		exit.kind = exitCrashed
+		exit.reason = "server stopped answering pings"
+	case server.stopping:
+		exit.kind = exitStopped
+		exit.reason = "stopped by the starter"
+	case exit.code == 0 && (server.stopSeen || exit.ready):
+		exit.kind = exitStopped
+		exit.reason = "server was stopped"
+	// An OutOfMemoryError the server recovered from does not turn a later
+	// clean stop into a crash
+	case server.oomSeen:
+		exit.kind = exitOutOfMemory
+		exit.reason = "server ran out of memory"
+	case isSignaled:
+		exit.kind = exitKilled
+		exit.reason = fmt.Sprintf("killed by signal %s", signaled)
+	case exit.code == 0:
+		exit.kind = exitCrashed
+		exit.reason = "server exited before it was ready"
+	default:
+		exit.kind = exitCrashed
+		exit.reason = fmt.Sprintf("exit code %d", exit.code)
+	}
+
+	return exit
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Matches the first line of java -version, like
+// openjdk version "17.0.2" 2022-01-18 or java version "1.8.0_312"
+var javaVersionPattern = regexp.MustCompile(`version "([^"]+)"`)
+
+// javaRuntime is a java executable found on the host
+type javaRuntime struct {
+	path    string
+	version string
+	major   int
+}
+
+// javaRequirement is the range of Java majors a Minecraft version runs on,
+// a max of 0 has no upper bound
+type javaRequirement struct {
+	min int
+	max int
+}
+
+func (r javaRequirement) fits(major int) bool {
+	return major >= r.min && (r.max == 0 || major <= r.max)
+}
+
+func (r javaRequirement) String() string {
+	switch {
+	case r.max == 0:
+		return fmt.Sprintf("Java %d or newer", r.min)
+	case r.min == r.max:
+		return fmt.Sprintf("Java %d", r.min)
+	}
+	return fmt.Sprintf("Java %d to %d", r.min, r.max)
+}
+
+// Needed by the newest Minecraft versions. Versions the starter does not
+// know, like snapshots, are assumed to need it as well.
+var newestJavaRequirement = javaRequirement{25, 0}
+
+// javaRequirementFor returns the Java versions a Minecraft version and its
+// loaders work with
+func javaRequirementFor(mcVersion string) javaRequirement {
+	major, minor, patch, _ := mcVersionParts(mcVersion)
+	switch {
+	// Also the versions named after the year like 26.1
+	case !knownMcVersion(mcVersion) || major >= 26:
+		return newestJavaRequirement
+	case minor < 13:
+		return javaRequirement{8, 8}
+	case minor < 17:
+		return javaRequirement{8, 11}
+	case minor == 17:
+		return javaRequirement{16, 0}
+	case minor < 20 || (minor == 20 && patch < 5):
+		return javaRequirement{17, 0}
+	}
+	return javaRequirement{21, 0}
+}
+
+// Split 1.18.2 into 1, 18 and 2, pre-releases like 1.20.5-rc1 count as the
+// release. ok is false for versions like snapshots that are no numbers.
+func mcVersionParts(mcVersion string) (major int, minor int, patch int, ok bool) {
+	if i := strings.Index(mcVersion, "-"); i >= 0 {
+		mcVersion = mcVersion[:i]
+	}
+	parts := strings.Split(mcVersion, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, 0, 0, false
+	}
+
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, 0, 0, false
+		}
+		numbers[i] = n
+	}
+	return numbers[0], numbers[1], numbers[2], true
+}
+
+// knownMcVersion tells if the Java requirement of a version is known, and
+// not just assumed to be the newest. Versions are 1.x or, since 26.1, named
+// after the year.
+func knownMcVersion(mcVersion string) bool {
+	major, _, _, ok := mcVersionParts(mcVersion)
+	return ok && (major == 1 || major >= 26)
+}
+
+// parseJavaVersion reads the version from the output of java -version
+func parseJavaVersion(output string) (string, int, error) {
+	match := javaVersionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return "", 0, fmt.Errorf("no version in %q", strings.TrimSpace(output))
+	}
+	version := match[1]
+
+	// Up to Java 8 the major is the second part of 1.8.0_312
+	parts := strings.FieldsFunc(version, func(r rune) bool {
+		return r == '.' || r == '_' || r == '-' || r == '+'
+	})
+	if len(parts) > 1 && parts[0] == "1" {
+		parts = parts[1:]
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid java version %q", version)
+	}
+
+	return version, major, nil
+}
+
+func probeJava(path string) (*javaRuntime, error) {
+	out, err := exec.Command(path, "-version").CombinedOutput()
+	if err != nil {
+		return nil, err
+	}
+	version, major, err := parseJavaVersion(string(out))
+	if err != nil {
+		return nil, err
+	}
+
+	return &javaRuntime{path: path, version: version, major: major}, nil
+}
+
+// javaCandidates lists the java executables installed in the usual places
+func javaCandidates() []string {
+	executable := "java"
+	if runtime.GOOS == "windows" {
+		executable = "java.exe"
+	}
+
+	var candidates []string
+	if javaHome := os.Getenv("JAVA_HOME"); javaHome != "" {
+		candidates = append(candidates, filepath.Join(javaHome, "bin", executable))
+	}
+	if path, err := exec.LookPath("java"); err == nil {
+		candidates = append(candidates, path)
+	}
+
+	var patterns []string
+	sdkman := os.Getenv("SDKMAN_DIR")
+	if sdkman == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			sdkman = filepath.Join(home, ".sdkman")
+		}
+	}
+	if sdkman != "" {
+		patterns = append(patterns, filepath.Join(sdkman, "candidates", "java", "*", "bin", executable))
+	}
+	switch runtime.GOOS {
+	case "linux":
+		patterns = append(patterns, filepath.Join("/usr/lib/jvm", "*", "bin", executable))
+	case "darwin":
+		patterns = append(patterns, filepath.Join("/Library/Java/JavaVirtualMachines", "*", "Contents", "Home", "bin", executable))
+	case "windows":
+		for _, vendor := range []string{"Java", "Eclipse Adoptium", "Microsoft", "Zulu"} {
+			patterns = append(patterns, filepath.Join(os.Getenv("ProgramFiles"), vendor, "*", "bin", executable))
+		}
+	}
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		candidates = append(candidates, matches...)
+	}
+
+	// The same runtime is often reachable through several symlinks
+	seen := map[string]bool{}
+	var unique []string
+	for _, candidate := range candidates {
+		resolved, err := filepath.EvalSymlinks(candidate)
+		if err != nil || seen[resolved] {
+			continue
+		}
+		seen[resolved] = true
+		unique = append(unique, candidate)
+	}
+
+	return unique
+}
+
+// findJava picks the installed java that fits the Minecraft version best,
+// the oldest one that is new enough
+func findJava(mcVersion string) (*javaRuntime, error) {
+	required := javaRequirementFor(mcVersion)
+
+	var best *javaRuntime
+	var found []string
+	for _, candidate := range javaCandidates() {
+		java, err := probeJava(candidate)
+		if err != nil {
+			log.Debugf("Skipping java %s: %v", candidate, err)
+			continue
+		}
+		found = append(found, fmt.Sprintf("%s (%s)", java.path, java.version))
+		if !required.fits(java.major) {
+			continue
+		}
+		if best == nil || java.major < best.major {
+			best = java
+		}
+	}
+
+	if best == nil {
+		if len(found) == 0 {
+			return nil, fmt.Errorf("Minecraft %s needs %s, but no java was found. Install one or set forcedJavaPath", mcVersion, required)
+		}
+		return nil, fmt.Errorf("Minecraft %s needs %s, but only found %s. Install a fitting one or set forcedJavaPath", mcVersion, required, strings.Join(found, ", "))
+	}
+
+	return best, nil
+}
+
+// selectJava decides which java runs the installer and the server. A
+// forcedJavaPath is used as is, only its version is checked. Managed runtimes
+// come before the ones installed on the host.
+func (l *loaderManager) selectJava(mcVersion string) error {
+	if mcVersion != "" && !knownMcVersion(mcVersion) {
+		log.Warnf("Unknown Minecraft version %s, assuming it needs %s. Set forcedJavaPath to use another java.", mcVersion, newestJavaRequirement)
+	}
+
+	if l.launchConfig.ForcedJavaPath != "" {
+		java, err := probeJava(l.launchConfig.ForcedJavaPath)
+		if err != nil {
+			return fmt.Errorf("forcedJavaPath %s does not work: %v", l.launchConfig.ForcedJavaPath, err)
+		}
+		if mcVersion != "" && !javaRequirementFor(mcVersion).fits(java.major) {
+			log.Warnf("forcedJavaPath is Java %s, but Minecraft %s needs %s", java.version, mcVersion, javaRequirementFor(mcVersion))
+		}
+		l.java = java
+		return nil
+	}
+
+	if l.launchConfig.ManagedJava.Enabled && mcVersion != "" {
+		java, err := l.managedJava(javaRequirementFor(mcVersion).min)
+		if err != nil {
+			return err
+		}
+		log.Infof("Using managed Java %s from %s", java.version, java.path)
+		l.java = java
+		return nil
+	}
+
+	if mcVersion == "" {
+		log.Warn("Minecraft version unknown, using java from PATH without checking its version")
+		java, err := probeJava("java")
+		if err != nil {
+			return fmt.Errorf("no working java in PATH: %v", err)
+		}
+		l.java = java
+		return nil
+	}
+
+	java, err := findJava(mcVersion)
+	if err != nil {
+		return err
+	}
+	log.Infof("Using Java %s from %s", java.version, java.path)
+	l.java = java
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Strange-Account/go-mc-server-starter/utils"
+)
+
+const adoptiumApiUrl = "https://api.adoptium.net/v3/assets/latest/{{@javaversion@}}/hotspot?architecture={{@arch@}}&image_type={{@imagetype@}}&os={{@os@}}&vendor=eclipse"
+
+// Written into a runtime directory once it is completely extracted
+const runtimeCompleteFile = ".serverstarter-complete"
+
+type adoptiumAsset struct {
+	ReleaseName string `json:"release_name"`
+	Binary      struct {
+		Package struct {
+			Name     string `json:"name"`
+			Link     string `json:"link"`
+			Checksum string `json:"checksum"`
+		} `json:"package"`
+	} `json:"binary"`
+}
+
+// Operating system and architecture in the names Adoptium uses
+func adoptiumPlatform() (string, string) {
+	osName := runtime.GOOS
+	if osName == "darwin" {
+		osName = "mac"
+	}
+
+	arch := runtime.GOARCH
+	switch arch {
+	case "amd64":
+		arch = "x64"
+	case "arm64":
+		arch = "aarch64"
+	case "386":
+		arch = "x32"
+	}
+
+	return osName, arch
+}
+
+func (l *loaderManager) runtimesPath() (string, error) {
+	if l.launchConfig.ManagedJava.RuntimesPath != "" {
+		return filepath.Abs(l.launchConfig.ManagedJava.RuntimesPath)
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "serverstarter", "runtimes"), nil
+}
+
+// managedJava returns the downloaded runtime for a Java major, downloading
+// it first if needed
+func (l *loaderManager) managedJava(major int) (*javaRuntime, error) {
+	runtimesPath, err := l.runtimesPath()
+	if err != nil {
+		return nil, err
+	}
+	osName, arch := adoptiumPlatform()
+	runtimePath := filepath.Join(runtimesPath, fmt.Sprintf("java%d-%s-%s", major, osName, arch))
+
+	if _, err := os.Stat(filepath.Join(runtimePath, runtimeCompleteFile)); err != nil {
+		err = l.downloadRuntime(major, runtimePath)
+		if err != nil {
+			return nil, fmt.Errorf("downloading Java %d failed: %v", major, err)
+		}
+	}
+
+	java, err := findRuntimeJava(runtimePath)
+	if err != nil {
+		return nil, err
+	}
+	return probeJava(java)
+}
+
+// downloadRuntime fetches, verifies and extracts a runtime into runtimePath
+func (l *loaderManager) downloadRuntime(major int, runtimePath string) error {
+	url, checksum, err := l.runtimeDownload(major)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(runtimePath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// Instances sharing the runtimes directory may download at the same
+	// time, everything happens in a private directory first
+	tempPath, err := ioutil.TempDir(filepath.Dir(runtimePath), ".download-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempPath)
+
+	archiveName := filepath.Base(strings.SplitN(url, "?", 2)[0])
+	archivePath := filepath.Join(tempPath, archiveName)
+	log.Infof("Downloading Java %d from %s", major, url)
+	err = utils.DownloadFile(archivePath, url)
+	if err != nil {
+		return err
+	}
+
+	actual, err := sha256File(archivePath)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, checksum) {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", url, checksum, actual)
+	}
+
+	extractPath := filepath.Join(tempPath, "runtime")
+	if strings.HasSuffix(archiveName, ".zip") {
+		_, err = utils.Unzip(archivePath, extractPath)
+	} else {
+		err = utils.Untar(archivePath, extractPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(filepath.Join(extractPath, runtimeCompleteFile), []byte(url+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+
+	// An incomplete leftover is replaced, a complete one from another
+	// instance is kept
+	if _, err := os.Stat(filepath.Join(runtimePath, runtimeCompleteFile)); err == nil {
+		return nil
+	}
+	os.RemoveAll(runtimePath)
+	err = os.Rename(extractPath, runtimePath)
+	if err != nil {
+		if _, statErr := os.Stat(filepath.Join(runtimePath, runtimeCompleteFile)); statErr == nil {
+			return nil
+		}
+		return err
+	}
+
+	log.Infof("Java %d installed to %s", major, runtimePath)
+	return nil
+}
+
+// runtimeDownload returns the url and SHA-256 of the runtime archive
+func (l *loaderManager) runtimeDownload(major int) (string, string, error) {
+	osName, arch := adoptiumPlatform()
+	replacer := strings.NewReplacer(
+		"{{@javaversion@}}", strconv.Itoa(major),
+		"{{@os@}}", osName,
+		"{{@arch@}}", arch,
+		"{{@imagetype@}}", l.launchConfig.ManagedJava.ImageType,
+	)
+
+	if l.launchConfig.ManagedJava.UrlTemplate != "" {
+		url := replacer.Replace(l.launchConfig.ManagedJava.UrlTemplate)
+		checksumUrl := url + ".sha256.txt"
+		if l.launchConfig.ManagedJava.ChecksumUrlTemplate != "" {
+			checksumUrl = replacer.Replace(l.launchConfig.ManagedJava.ChecksumUrlTemplate)
+		}
+
+		body, err := httpGet(checksumUrl)
+		if err != nil {
+			return "", "", fmt.Errorf("no checksum for %s: %v", url, err)
+		}
+		// sha256sum format, the hash followed by the file name
+		fields := strings.Fields(string(body))
+		if len(fields) == 0 {
+			return "", "", fmt.Errorf("empty checksum file %s", checksumUrl)
+		}
+		return url, fields[0], nil
+	}
+
+	body, err := httpGet(replacer.Replace(adoptiumApiUrl))
+	if err != nil {
+		return "", "", err
+	}
+	var assets []adoptiumAsset
+	err = json.Unmarshal(body, &assets)
+	if err != nil {
+		return "", "", err
+	}
+	if len(assets) == 0 {
+		return "", "", fmt.Errorf("Adoptium has no Java %d %s for %s %s", major, l.launchConfig.ManagedJava.ImageType, osName, arch)
+	}
+
+	asset := assets[0]
+	log.Infof("Latest Java %d is %s", major, asset.ReleaseName)
+	return asset.Binary.Package.Link, asset.Binary.Package.Checksum, nil
+}
+
+// findRuntimeJava looks for the java executable in an extracted runtime, the
+// archives contain a single top directory
+func findRuntimeJava(runtimePath string) (string, error) {
+	executable := "java"
+	if runtime.GOOS == "windows" {
+		executable = "java.exe"
+	}
+
+	for _, pattern := range []string{
+		filepath.Join(runtimePath, "bin", executable),
+		filepath.Join(runtimePath, "*", "bin", executable),
+		filepath.Join(runtimePath, "*", "Contents", "Home", "bin", executable),
+	} {
+		matches, _ := filepath.Glob(pattern)
+		if len(matches) > 0 {
+			return matches[0], nil
+		}
+	}
+
+	return "", fmt.Errorf("no java executable in %s", runtimePath)
+}
+
+func httpGet(url string) ([]byte, error) {
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("requesting %s failed: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Aikar's flags use larger young generations for heaps of this size
+const largeHeap = 12 * 1024 * mebibyte
+
+// javaFlag is a flag of a preset, limited to the Java versions knowing it.
+// A maxJava of 0 has no upper bound.
+type javaFlag struct {
+	flag    string
+	minJava int
+	maxJava int
+}
+
+// Named sets of JVM flags for launch.javaPreset
+var javaPresets = map[string][]javaFlag{
+	// https://docs.papermc.io/paper/aikars-flags
+	"aikar": {
+		{"-XX:+UseG1GC", 0, 0},
+		{"-XX:+ParallelRefProcEnabled", 0, 0},
+		{"-XX:MaxGCPauseMillis=200", 0, 0},
+		{"-XX:+UnlockExperimentalVMOptions", 0, 0},
+		{"-XX:+DisableExplicitGC", 0, 0},
+		{"-XX:+AlwaysPreTouch", 0, 0},
+		{"-XX:G1NewSizePercent=30", 0, 0},
+		{"-XX:G1MaxNewSizePercent=40", 0, 0},
+		{"-XX:G1HeapRegionSize=8M", 0, 0},
+		{"-XX:G1ReservePercent=20", 0, 0},
+		{"-XX:G1HeapWastePercent=5", 0, 0},
+		{"-XX:G1MixedGCCountTarget=4", 0, 0},
+		{"-XX:InitiatingHeapOccupancyPercent=15", 0, 0},
+		{"-XX:G1MixedGCLiveThresholdPercent=90", 0, 0},
+		{"-XX:G1RSetUpdatingPauseTimePercent=5", 0, 19},
+		{"-XX:SurvivorRatio=32", 0, 0},
+		{"-XX:+PerfDisableSharedMem", 0, 0},
+		{"-XX:MaxTenuringThreshold=1", 0, 0},
+		{"-Dusing.aikars.flags=https://mcflags.emc.gs", 0, 0},
+		{"-Daikars.new.flags=true", 0, 0},
+	},
+	"zgc": {
+		{"-XX:+UnlockExperimentalVMOptions", 11, 14},
+		{"-XX:+UseZGC", 11, 0},
+		{"-XX:+ZGenerational", 21, 22},
+		{"-XX:+AlwaysPreTouch", 0, 0},
+		{"-XX:+DisableExplicitGC", 0, 0},
+		{"-XX:+PerfDisableSharedMem", 0, 0},
+	},
+	"shenandoah": {
+		{"-XX:+UseShenandoahGC", 12, 0},
+		{"-XX:+ParallelRefProcEnabled", 0, 0},
+		{"-XX:+AlwaysPreTouch", 0, 0},
+		{"-XX:+DisableExplicitGC", 0, 0},
+		{"-XX:+PerfDisableSharedMem", 0, 0},
+	},
+	"minimal": {
+		{"-XX:+UseG1GC", 0, 0},
+		{"-XX:+DisableExplicitGC", 0, 0},
+	},
+}
+
+// Replacements in Aikar's flags for large heaps
+var aikarLargeHeapFlags = []string{
+	"-XX:G1NewSizePercent=40",
+	"-XX:G1MaxNewSizePercent=50",
+	"-XX:G1HeapRegionSize=16M",
+	"-XX:G1ReservePercent=15",
+	"-XX:InitiatingHeapOccupancyPercent=20",
+}
+
+// Presets needing a minimum Java version as a whole
+var javaPresetMinJava = map[string]int{
+	"zgc":        11,
+	"shenandoah": 12,
+}
+
+// javaFlagKey identifies what a flag sets, so explicit javaArgs can replace
+// flags of a preset
+func javaFlagKey(flag string) string {
+	switch {
+	case strings.HasPrefix(flag, "-XX:+"), strings.HasPrefix(flag, "-XX:-"):
+		return "-XX:" + flag[5:]
+	case strings.HasPrefix(flag, "-XX:"), strings.HasPrefix(flag, "-D"):
+		return strings.SplitN(flag, "=", 2)[0]
+	case strings.HasPrefix(flag, "-Xmx"), strings.HasPrefix(flag, "-Xms"), strings.HasPrefix(flag, "-Xss"):
+		return flag[:4]
+	}
+	return flag
+}
+
+// presetArgs returns the flags of a preset for a Java version, without the
+// ones javaArgs sets itself
+func presetArgs(preset string, javaMajor int, heap int64, javaArgs []string) ([]string, error) {
+	if preset == "" {
+		return nil, nil
+	}
+	flags, ok := javaPresets[preset]
+	if !ok {
+		var names []string
+		for name := range javaPresets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown javaPreset %q, use one of %s", preset, strings.Join(names, ", "))
+	}
+	if javaMajor < javaPresetMinJava[preset] {
+		return nil, fmt.Errorf("javaPreset %s needs Java %d or newer, the server runs on Java %d", preset, javaPresetMinJava[preset], javaMajor)
+	}
+
+	replaced := map[string]string{}
+	if preset == "aikar" && heap >= largeHeap {
+		for _, flag := range aikarLargeHeapFlags {
+			replaced[javaFlagKey(flag)] = flag
+		}
+	}
+
+	explicit := map[string]bool{}
+	for _, arg := range javaArgs {
+		explicit[javaFlagKey(arg)] = true
+	}
+
+	var args []string
+	for _, f := range flags {
+		if javaMajor < f.minJava || (f.maxJava != 0 && javaMajor > f.maxJava) {
+			continue
+		}
+		key := javaFlagKey(f.flag)
+		if explicit[key] {
+			continue
+		}
+		if flag, ok := replaced[key]; ok {
+			args = append(args, flag)
+			continue
+		}
+		args = append(args, f.flag)
+	}
+
+	return args, nil
+}
+
+// heapSize returns the size of the last -Xmx in args, 0 if there is none
+func heapSize(args []string) int64 {
+	var heap int64
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-Xmx") {
+			continue
+		}
+		size, _, _, err := parseMemorySize(arg[4:])
+		if err == nil {
+			heap = size
+		}
+	}
+	return heap
+}
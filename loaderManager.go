@@ -1,19 +1,22 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/Strange-Account/go-mc-server-starter/config"
+	"github.com/Strange-Account/go-mc-server-starter/console"
+	"github.com/Strange-Account/go-mc-server-starter/packagetypes"
 	"github.com/Strange-Account/go-mc-server-starter/utils"
 )
 
@@ -21,6 +24,30 @@ type loaderManager struct {
 	launchConfig config.LaunchConfig
 	lockfile     *config.LockFile
 	basePath     string
+	acceptEula   bool
+
+	shutdownTimeout time.Duration
+	killTimeout     time.Duration
+	readyTimeout    time.Duration
+	readyPatterns   []*regexp.Regexp
+
+	watchdogInterval time.Duration
+	watchdogTimeout  time.Duration
+
+	java       *javaRuntime
+	heapArgs   []string
+	presetArgs []string
+
+	console *console.Console
+	// Held while saving is paused for a copy of the world
+	saveMutex sync.Mutex
+
+	mutex         sync.Mutex
+	server        *serverProcess
+	stopRequested bool
+	stopCh        chan struct{}
+	// The starter stopped the server to start it again
+	restartRequested bool
 }
 
 func NewLoaderManager(config config.LaunchConfig, lockfile *config.LockFile, basePath string) *loaderManager {
@@ -28,176 +55,467 @@ func NewLoaderManager(config config.LaunchConfig, lockfile *config.LockFile, bas
 	l.launchConfig = config
 	l.lockfile = lockfile
 	l.basePath = basePath
+	l.console = console.New(os.Stdout)
+	l.stopCh = make(chan struct{})
 
 	return &l
 }
 
-func (l *loaderManager) installLoader(loaderVersion string, mcVersion string, installerArguments []string) {
+func installerUrl(loaderVersion string, mcVersion string) string {
 	url := "http://files.minecraftforge.net/maven/net/minecraftforge/forge/{{@mcversion@}}-{{@loaderversion@}}/forge-{{@mcversion@}}-{{@loaderversion@}}-installer.jar"
 	url = strings.ReplaceAll(url, "{{@loaderversion@}}", loaderVersion)
 	url = strings.ReplaceAll(url, "{{@mcversion@}}", mcVersion)
+	return url
+}
+
+// Record the loader install steps in plan
+func (l *loaderManager) planLoader(plan *packagetypes.Plan, loaderVersion string, mcVersion string, installerArguments []string) {
+	plan.Add(packagetypes.ActionDownload, installerUrl(loaderVersion, mcVersion), "installer.jar", "loader installer")
+	command := strings.Join(append([]string{l.javaPath(), "-jar", "installer.jar"}, installerArguments...), " ")
+	if l.launchConfig.PreJavaArgs != "" {
+		command = l.launchConfig.PreJavaArgs + " " + command
+	}
+	plan.Add(packagetypes.ActionRun, command, "", "install loader")
+	plan.Add(packagetypes.ActionDelete, "", "installer.jar", "loader installer")
+}
 
-	installerPath := filepath.Join(l.basePath, "installer.jar")
+const loaderStagingDirName = ".serverstarter-loader"
 
-	log.Infof("Attempting to download installer from %s", url)
-	err := utils.DownloadFile(installerPath, url)
+// The installer runs in a staging directory, its output is moved into
+// basePath afterwards so ignoreFiles applies to loader files too
+func (l *loaderManager) installLoader(loaderVersion string, mcVersion string, installerArguments []string, ignoreFiles []string) error {
+	url := installerUrl(loaderVersion, mcVersion)
+
+	ignore, err := utils.NewIgnoreMatcher(ignoreFiles)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	log.Info("Starting installation of Loader, installer output incoming")
-	log.Info("Check log for installer for more information")
+	stagingPath, err := filepath.Abs(filepath.Join(l.basePath, loaderStagingDirName))
+	if err != nil {
+		return err
+	}
+	os.RemoveAll(stagingPath)
+	defer os.RemoveAll(stagingPath)
 
-	absInstallerPath, err := filepath.Abs(installerPath)
+	err = os.MkdirAll(stagingPath, os.ModePerm)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
+	installerPath := filepath.Join(stagingPath, "installer.jar")
+
+	log.Infof("Attempting to download installer from %s", url)
+	err = utils.DownloadFile(installerPath, url)
+	if err != nil {
+		return err
+	}
+
+	err = l.selectJava(mcVersion)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Starting installation of Loader, installer output incoming")
+	log.Info("Check log for installer for more information")
+
 	var args []string
-	args = append(args, "-jar", absInstallerPath)
+	args = append(args, "-jar", installerPath)
 	args = append(args, installerArguments...)
 
-	cmd := exec.Command("java", args...)
-	cmd.Dir = l.basePath
+	cmd, err := l.javaCommand(l.javaPath(), args)
+	if err != nil {
+		return err
+	}
+	cmd.Dir = stagingPath
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Run(); err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	log.Info("Done installing loader, deleting installer!")
 
+	err = os.Remove(installerPath)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Moving loader files into place")
+	err = moveLoaderFiles(stagingPath, l.basePath, ignore)
+	if err != nil {
+		return err
+	}
+	ignore.Report()
+
 	l.lockfile.LoaderInstalled = true
 	l.lockfile.LoaderVersion = loaderVersion
 	l.lockfile.McVersion = mcVersion
 	l.lockfile.Write(l.basePath)
 
-	err = os.Remove(absInstallerPath)
-	if err != nil {
-		log.Fatal(err)
-	}
+	return nil
+}
 
-	checkEULA(l.basePath)
+func moveLoaderFiles(stagingPath string, basePath string, ignore *utils.IgnoreMatcher) error {
+	return filepath.Walk(stagingPath,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(stagingPath, path)
+			if err != nil {
+				return err
+			}
+			if ignore.Skip(rel) {
+				return nil
+			}
+			dest := filepath.Join(basePath, rel)
+			err = os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+			if err != nil {
+				return err
+			}
+			return os.Rename(path, dest)
+		})
 }
 
-func checkEULA(basePath string) {
-	var lines []string
+// handleServer runs the server until it is stopped. An error means the
+// restart policy gave up on it.
+func (l *loaderManager) handleServer() error {
+	counter := 0
 
-	eulaFilePath := filepath.Join(basePath, "eula.txt")
+	// Before the console starts reading stdin, the prompt needs it
+	err := l.checkEULA()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	if _, err := os.Stat(eulaFilePath); err == nil {
-		f, err := os.Open(eulaFilePath)
+	restart, err := newRestartPolicy(l.launchConfig.CrashLimit, l.launchConfig.Restart)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The crash moving a mod counts towards the limit, there has to be a
+	// start without it left
+	crashLimit, quarantineCrashes := l.launchConfig.CrashLimit, l.launchConfig.Quarantine.Crashes
+	if l.launchConfig.Quarantine.Enabled && crashLimit > 0 && crashLimit <= quarantineCrashes {
+		log.Fatalf("crashLimit %d must be larger than quarantine.crashes %d", crashLimit, quarantineCrashes)
+	}
+	err = l.selectJava(l.lockfile.McVersion)
+	if err != nil {
+		log.Fatal(err)
+	}
+	l.shutdownTimeout, err = time.ParseDuration(l.launchConfig.ShutdownTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	l.killTimeout, err = time.ParseDuration(l.launchConfig.KillTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	l.readyTimeout, err = time.ParseDuration(l.launchConfig.ReadyTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	l.readyPatterns, err = compileReadyPatterns(l.launchConfig.ReadyPatterns)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if l.launchConfig.Watchdog.Enabled {
+		l.watchdogInterval, err = time.ParseDuration(l.launchConfig.Watchdog.Interval)
 		if err != nil {
 			log.Fatal(err)
 		}
-		defer f.Close()
-
-		scanner := bufio.NewScanner(f)
-		for scanner.Scan() {
-			lines = append(lines, scanner.Text())
-		}
-
-		if err := scanner.Err(); err != nil {
+		l.watchdogTimeout, err = time.ParseDuration(l.launchConfig.Watchdog.Timeout)
+		if err != nil {
 			log.Fatal(err)
 		}
-	} else if os.IsNotExist(err) {
-		lines = append(lines, "#By changing the setting below to TRUE you are indicating your agreement to our EULA (https://account.mojang.com/documents/minecraft_eula).")
-		lines = append(lines, "#"+time.Now().Format("E MMM d HH:mm:ss O y"))
-		lines = append(lines, "eula=false")
-	} else {
+		if l.launchConfig.Watchdog.MaxFailures < 1 {
+			log.Fatalf("watchdog.maxFailures must be at least 1, got %d", l.launchConfig.Watchdog.MaxFailures)
+		}
+	}
+
+	l.heapArgs, err = l.memoryArgs()
+	if err != nil {
+		log.Fatal(err)
+	}
+	heap := heapSize(l.launchConfig.JavaArgs)
+	if heap == 0 {
+		heap = heapSize(l.heapArgs)
+	}
+	l.presetArgs, err = presetArgs(l.launchConfig.JavaPreset, l.java.major, heap, l.launchConfig.JavaArgs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := utils.SplitCommand(l.launchConfig.PreJavaArgs); err != nil {
+		log.Fatalf("preJavaArgs: %v", err)
+	}
+	tasks, err := parseSchedule(l.launchConfig.Schedule)
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	envEula := strings.ToLower(os.Getenv("EULA"))
-	if envEula == "true" {
-		lines[2] = "eula=true"
-		err := writeEula(basePath, lines)
+	// The ram disk needs the level-name from it
+	err = l.applyServerProperties()
+	if err != nil {
+		log.Fatalf("Could not update server.properties: %v", err)
+	}
+	err = l.applyPlayers()
+	if err != nil {
+		log.Errorf("Could not update operators, whitelist and bans: %v", err)
+	}
+
+	if l.launchConfig.RamDisk {
+		syncInterval, err := time.ParseDuration(l.launchConfig.RamDiskSyncInterval)
 		if err != nil {
 			log.Fatal(err)
 		}
-		return
+		ramDisk, err := l.setupRamDisk()
+		if err != nil {
+			log.Fatalf("Could not move the world to the ram disk: %v", err)
+		}
+		if ramDisk != nil {
+			ramDisk.start(syncInterval)
+			defer ramDisk.close()
+		}
 	}
 
-	if len(lines) > 2 && !strings.Contains(lines[2], "true") {
-		log.Info("You have not accepted the eula yet.")
-		log.Info("By typing TRUE you are indicating your agreement to the EULA of Mojang.")
-		log.Info("Read it at https://account.mojang.com/documents/minecraft_eula before accepting it.")
-		reader := bufio.NewReader(os.Stdin)
-		text, _ := reader.ReadString('\n')
-		if strings.ToLower(text) == "true" {
-			log.Info("You have accepted the EULA.")
-			lines[2] = "eula=true"
+	go l.console.ForwardInput(os.Stdin)
 
-			err := writeEula(basePath, lines)
-			if err != nil {
-				log.Fatal(err)
-			}
+	if socketPath := l.consoleSocketPath(); socketPath != "" {
+		listener, err := l.console.Serve(socketPath)
+		if err != nil {
+			log.Errorf("Console socket not available: %v", err)
+		} else {
+			defer os.Remove(socketPath)
+			defer listener.Close()
 		}
 	}
-}
 
-func (l *loaderManager) handleServer() {
-	var startTimes []time.Time
-	counter := 0
+	var quarantine *modQuarantine
+	if l.launchConfig.Quarantine.Enabled {
+		quarantine = newModQuarantine(l.basePath, l.launchConfig.Quarantine)
+	}
 
-	checkEULA(l.basePath)
+	go l.handleSignals()
 
-	crashLimit := l.launchConfig.CrashLimit
-	crashTimer, err := time.ParseDuration(l.launchConfig.CrashTimer)
-	if err != nil {
-		log.Fatal(err)
-	}
+	stopSchedule := l.startSchedule(tasks)
+	defer stopSchedule()
 
-	for len(startTimes) < crashLimit {
-		startTimes = append(startTimes, time.Now())
+	for {
 		counter++
 
+		if quarantine != nil {
+			quarantine.report()
+		}
+
 		log.Infof("Starting server. Try %d", counter)
-		l.startServer()
+		exit := l.startServer()
+
+		if exit.isCrash() {
+			log.Errorf("Server exited, %s", exit)
+			if exit.report != nil {
+				exit.report.printSummary()
+			}
+		} else {
+			log.Infof("Server exited, %s", exit)
+		}
+
+		if l.isStopRequested() {
+			return nil
+		}
+
+		if l.takeRestartRequest() {
+			continue
+		}
+
+		if !exit.isCrash() {
+			log.Info("Server was stopped, not restarting")
+			return nil
+		}
 
 		if !l.launchConfig.AutoRestart {
-			return
+			return nil
 		}
 
-		var tempStartTimes []time.Time
-		for _, startTime := range startTimes {
-			if startTime.Add(crashTimer).After(time.Now()) {
-				tempStartTimes = append(tempStartTimes, startTime)
+		// A quarantine still counts as a crash, so a pack blaming another mod
+		// every time backs off and gives up in the end
+		if quarantine != nil {
+			if exit.ready {
+				quarantine.reset()
+			} else {
+				quarantine.startupCrashed(exit)
 			}
 		}
-		startTimes = tempStartTimes
-		log.Errorf("Server crashed %d times in the last %s.", len(startTimes), l.launchConfig.CrashTimer)
 
-		if !l.launchConfig.AutoRestart {
-			return
+		delay, ok := restart.crashed(exit)
+		if !ok {
+			err := restart.runGiveUp(exit)
+			if err == nil && restart.staysStopped() {
+				<-l.stopCh
+			}
+			return err
 		}
 
-		log.Info("Restarting in 10 Seconds")
+		log.Infof("Restarting in %s", delay.Round(time.Second))
 		log.Info("Press Ctrl+C to cancel.")
-		time.Sleep(10 * time.Second)
+		select {
+		case <-time.After(delay):
+		case <-l.stopCh:
+			return nil
+		}
 	}
 }
 
-func (l *loaderManager) startServer() {
-	// Process os signals
+// The first signal stops the server gracefully, a second one kills it
+func (l *loaderManager) handleSignals() {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 
-	// basePath := l.config.Install.BaseInstallPath
+	for sig := range signals {
+		log.Infof("Recieved signal %s", sig)
+		if !l.isStopRequested() {
+			l.requestStop()
+			continue
+		}
+		if server := l.currentServer(); server != nil {
+			log.Warn("Stop already in progress, killing server")
+			server.cmd.Process.Kill()
+		}
+	}
+}
 
-	// World folder
-	// level := "world"
+// requestStop stops the running server and keeps it from being restarted
+func (l *loaderManager) requestStop() {
+	l.mutex.Lock()
+	if l.stopRequested {
+		l.mutex.Unlock()
+		return
+	}
+	l.stopRequested = true
+	close(l.stopCh)
+	server := l.server
+	l.mutex.Unlock()
 
-	// Get level folder
-	// server properties
-	propertiesFile := filepath.Join(l.basePath, "server.properties")
-	if _, err := os.Stat(propertiesFile); err == nil {
-		f, err := os.Open(propertiesFile)
-		if err != nil {
-			log.Fatal(err)
+	if server != nil {
+		go server.shutdown(l.shutdownTimeout, l.killTimeout)
+	}
+}
+
+// requestRestart stops the running server, the loop starts it again right
+// away
+func (l *loaderManager) requestRestart() {
+	l.mutex.Lock()
+	server := l.server
+	if l.stopRequested || server == nil {
+		l.mutex.Unlock()
+		return
+	}
+	l.restartRequested = true
+	l.mutex.Unlock()
+
+	server.shutdown(l.shutdownTimeout, l.killTimeout)
+}
+
+func (l *loaderManager) takeRestartRequest() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	restart := l.restartRequested
+	l.restartRequested = false
+	return restart
+}
+
+func (l *loaderManager) isStopRequested() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.stopRequested
+}
+
+func (l *loaderManager) currentServer() *serverProcess {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.server
+}
+
+// Register the running server, a stop requested before it started is
+// passed on right away
+func (l *loaderManager) setServer(server *serverProcess) {
+	l.mutex.Lock()
+	l.server = server
+	stop := l.stopRequested && server != nil
+	l.mutex.Unlock()
+
+	if stop {
+		go server.shutdown(l.shutdownTimeout, l.killTimeout)
+	}
+}
+
+func (l *loaderManager) javaPath() string {
+	if l.java != nil {
+		return l.java.path
+	}
+	if l.launchConfig.ForcedJavaPath != "" {
+		return l.launchConfig.ForcedJavaPath
+	}
+	return "java"
+}
+
+// javaCommand builds a java invocation, wrapped in the command from
+// launch.preJavaArgs like nice or taskset if one is set
+func (l *loaderManager) javaCommand(java string, args []string) (*exec.Cmd, error) {
+	wrapper, err := utils.SplitCommand(l.launchConfig.PreJavaArgs)
+	if err != nil {
+		return nil, fmt.Errorf("preJavaArgs: %v", err)
+	}
+	if len(wrapper) == 0 {
+		return exec.Command(java, args...), nil
+	}
+
+	wrapperArgs := append(wrapper[1:], java)
+	wrapperArgs = append(wrapperArgs, args...)
+	return exec.Command(wrapper[0], wrapperArgs...), nil
+}
+
+func (l *loaderManager) consoleSocketPath() string {
+	if l.launchConfig.ConsoleSocket == "" {
+		return ""
+	}
+	if filepath.IsAbs(l.launchConfig.ConsoleSocket) {
+		return l.launchConfig.ConsoleSocket
+	}
+	return filepath.Join(l.basePath, l.launchConfig.ConsoleSocket)
+}
+
+// withSavingPaused runs fn with saving turned off and the world flushed to
+// disk, so fn can copy it. Only one copy pauses saving at a time.
+func (l *loaderManager) withSavingPaused(fn func() error) error {
+	l.saveMutex.Lock()
+	defer l.saveMutex.Unlock()
+
+	if l.console.Running() {
+		err := l.console.Send("save-off")
+		if err == nil {
+			_, err = l.console.SendAndAwait("save-all flush", func(line string) bool {
+				return strings.Contains(line, "Saved the game")
+			}, time.Minute)
 		}
-		defer f.Close()
+		// A server that exited in the meantime writes nothing anymore
+		if err != nil && err != console.ErrNotRunning {
+			l.console.Send("save-on")
+			return fmt.Errorf("could not pause saving: %v", err)
+		}
+		defer l.console.Send("save-on")
+	}
+
+	return fn()
+}
+
+func (l *loaderManager) startServer() serverExit {
+	err := l.applyServerProperties()
+	if err != nil {
+		log.Errorf("Could not update server.properties: %v", err)
 	}
 
 	var startFile string
@@ -210,66 +528,63 @@ func (l *loaderManager) startServer() {
 	log.Infof("Using launcher file: %s", startFile)
 
 	launchJar := filepath.Join(l.basePath, startFile)
-	launchJar, err := filepath.Abs(launchJar)
+	launchJar, err = filepath.Abs(launchJar)
 	if err != nil {
 		log.Error(err)
 	}
-	java := "java"
-
-	if l.launchConfig.ForcedJavaPath != "" {
-		java = l.launchConfig.ForcedJavaPath
-	}
+	java := l.javaPath()
 
 	log.Info("Starting Loader, output incoming")
 	log.Info("For output of this check the server log")
 
 	// Build start command
 	var args []string
+	args = append(args, l.heapArgs...)
+	args = append(args, l.presetArgs...)
 	args = append(args, l.launchConfig.JavaArgs...)
 	args = append(args, "-jar", launchJar)
-	cmd := exec.Command(java, args...)
-	cmd.Dir = l.basePath
-
-	// Redirect Stdout/Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-
-	log.Debug(cmd)
-
-	// Start Server
-	err = cmd.Start()
+	cmd, err := l.javaCommand(java, args)
 	if err != nil {
-		log.Error(err)
+		return serverExit{kind: exitCrashed, code: -1, reason: err.Error()}
 	}
+	cmd.Dir = l.basePath
 
-	go func(cmd *exec.Cmd, launchConfig *config.LaunchConfig) {
-		sig := <-signals
-		log.Infof("Recieved signal %s", sig)
-		log.Info("Stopping server and wait 10 seconds to complete")
-		cmd.Process.Signal(syscall.SIGTERM)
-		launchConfig.AutoRestart = false
-		time.Sleep(10 * time.Second)
-	}(cmd, &l.launchConfig)
+	log.Infof("Command line: %s", strings.Join(cmd.Args, " "))
 
-	err = cmd.Wait()
+	// Start Server, its input and output go through the console
+	lines, unsubscribe := l.console.Subscribe()
+	server, err := startServerProcess(cmd, l.console)
 	if err != nil {
-		log.Error(err)
+		unsubscribe()
+		return serverExit{kind: exitCrashed, code: -1, reason: err.Error()}
 	}
-}
-
-func writeEula(basePath string, content []string) error {
-	eulaFilePath := filepath.Join(basePath, "eula.txt")
-
-	f, err := os.Create(eulaFilePath)
-	defer f.Close()
-
-	w := bufio.NewWriter(f)
-	for _, line := range content {
-		fmt.Fprintln(w, line)
+	l.setServer(server)
+	defer l.setServer(nil)
+
+	// Everything watching this run has to be done before it counts as over
+	var watchers sync.WaitGroup
+	watchers.Add(1)
+	go func() {
+		defer watchers.Done()
+		l.watchOutput(server, lines, unsubscribe)
+	}()
+
+	if l.launchConfig.Watchdog.Enabled {
+		watchers.Add(1)
+		go func() {
+			defer watchers.Done()
+			l.watchHang(server)
+		}()
 	}
 
-	err = w.Flush()
+	err = server.wait()
+	watchers.Wait()
+	// Returns once a shutdown still in progress is done
+	server.shutdown(l.shutdownTimeout, l.killTimeout)
 
-	return err
+	exit := classifyExit(server, err)
+	if exit.isCrash() {
+		exit.report = l.collectCrash(server, exit)
+	}
+	return exit
 }
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/Strange-Account/go-mc-server-starter/config"
+	"github.com/Strange-Account/go-mc-server-starter/console"
 	"github.com/Strange-Account/go-mc-server-starter/packagetypes"
 
 	log "github.com/sirupsen/logrus"
@@ -37,15 +39,109 @@ func checkConnection() bool {
 	return true
 }
 
+// Resolve pack and loader and print the install plan
+func printPlan(myConfig *config.ConfigFile, lockfile *config.LockFile, loaderManager *loaderManager, asJson bool) {
+	var plan *packagetypes.Plan
+
+	if lockfile.CheckShouldInstall() {
+		p := packagetypes.NewCursePack(myConfig)
+		var err error
+		plan, err = p.Plan()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if myConfig.Install.InstallLoader {
+			loaderManager.planLoader(plan, p.GetForgeVersion(), p.GetMCVersion(), myConfig.Install.InstallerArguments)
+		}
+	} else {
+		plan = &packagetypes.Plan{
+			Name:          myConfig.Modpack.Name,
+			PackUrl:       lockfile.PackUrl,
+			MCVersion:     lockfile.McVersion,
+			LoaderVersion: lockfile.LoaderVersion,
+			Installed:     true,
+		}
+	}
+
+	if asJson {
+		if err := plan.PrintJSON(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		plan.Print(os.Stdout)
+	}
+}
+
+// List the backups or restore the named one
+func restoreBackup(myConfig *config.ConfigFile, name string) {
+	basePath := myConfig.Install.BaseInstallPath
+
+	if name == "" {
+		backups, err := packagetypes.ListBackups(basePath, myConfig.Install.Backup)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(backups) == 0 {
+			fmt.Println("No backups found.")
+			return
+		}
+		fmt.Println("Available backups (restore with: restore <backup>):")
+		for _, b := range backups {
+			if b.Compressed {
+				fmt.Printf("  %s (compressed)\n", b.Name)
+			} else {
+				fmt.Printf("  %s\n", b.Name)
+			}
+		}
+		return
+	}
+
+	lockfile, err := packagetypes.RestoreBackup(basePath, myConfig.Install.Backup, name)
+	if err != nil {
+		log.Fatalf("Restoring backup %s failed: %v", name, err)
+	}
+	log.Infof("Restored backup %s (pack %s, Minecraft %s, loader %s)", name, lockfile.PackUrl, lockfile.McVersion, lockfile.LoaderVersion)
+}
+
+// Attach the terminal to the console socket of a running instance
+func attachConsole(socketPath string) {
+	if socketPath == "" {
+		log.Fatal("The console socket is disabled in the config (launch.consoleSocket)")
+	}
+
+	log.Infof("Attaching to %s, press Ctrl+D to detach", socketPath)
+	err := console.Connect(socketPath, os.Stdin, os.Stdout)
+	if err != nil {
+		log.Fatalf("Could not attach to console: %v", err)
+	}
+	log.Info("Detached")
+}
+
 // Main function
 func main() {
 	// Define program flags
 	configFileFlag := flag.String("c", "server-setup-config.yaml", "Path to server setup config yaml file")
 	versionFlag := flag.Bool("v", false, "Print version info")
+	dryRunFlag := flag.Bool("dry-run", false, "Print the install plan without changing anything (same as the plan command)")
+	jsonFlag := flag.Bool("json", false, "Print the install plan as JSON")
+	acceptEulaFlag := flag.Bool("accept-eula", false, "Accept the Minecraft EULA (https://aka.ms/MinecraftEULA)")
 
 	// Parse program flags
 	flag.Parse()
 
+	// Parse subcommand
+	command := flag.Arg(0)
+	if command == "plan" {
+		planFlags := flag.NewFlagSet("plan", flag.ExitOnError)
+		planJsonFlag := planFlags.Bool("json", *jsonFlag, "Print the install plan as JSON")
+		planFlags.Parse(flag.Args()[1:])
+		*dryRunFlag = true
+		*jsonFlag = *planJsonFlag
+	} else if command != "" && command != "restore" && command != "attach" && command != "rcon" {
+		log.Fatalf("Unknown command %s", command)
+	}
+
 	if *versionFlag {
 		fmt.Println(AppVersion)
 		os.Exit(0)
@@ -63,6 +159,28 @@ func main() {
 		log.Fatal("You are loading with an older Version of the specification!")
 	}
 
+	// Restore a backup instead of launching
+	if command == "restore" {
+		restoreBackup(myConfig, flag.Arg(1))
+		return
+	}
+
+	// Get loader manager
+	loaderManager := NewLoaderManager(myConfig.Launch, lockfile, myConfig.Install.BaseInstallPath)
+	loaderManager.acceptEula = *acceptEulaFlag
+
+	// Connect to the console of a running instance
+	if command == "attach" {
+		attachConsole(loaderManager.consoleSocketPath())
+		return
+	}
+
+	// Send a command over rcon to a running instance
+	if command == "rcon" {
+		runRconCommand(myConfig.Install.BaseInstallPath, strings.Join(flag.Args()[1:], " "))
+		return
+	}
+
 	// Print greeting
 	greeting(myConfig.Modpack.Name)
 
@@ -71,8 +189,11 @@ func main() {
 		log.Fatal("Problems with the Internet connection, shutting down.")
 	}
 
-	// Get loader manager
-	loaderManager := NewLoaderManager(myConfig.Launch, lockfile, myConfig.Install.BaseInstallPath)
+	// Only print what would happen
+	if *dryRunFlag {
+		printPlan(myConfig, lockfile, loaderManager, *jsonFlag)
+		return
+	}
 
 	// Should we install pack and loader?
 	if lockfile.CheckShouldInstall() {
@@ -80,23 +201,53 @@ func main() {
 		// TODO: different package types / abstraction
 		p := packagetypes.NewCursePack(myConfig)
 		// Install package
-		p.InstallPack()
+		if err := p.InstallPack(); err != nil {
+			log.Fatalf("Installing the pack failed, previous files are still in place: %v", err)
+		}
+
+		// Install loader if needed
+		if myConfig.Install.InstallLoader {
+			forgeVersion := p.GetForgeVersion()
+			mcVersion := p.GetMCVersion()
+			if err := loaderManager.installLoader(forgeVersion, mcVersion, myConfig.Install.InstallerArguments, myConfig.Install.IgnoreFiles); err != nil {
+				p.Rollback()
+				log.Fatalf("Installing the loader failed, previous files were restored: %v", err)
+			}
+		}
 
 		// Update lockfile
 		lockfile.PackInstalled = true
 		lockfile.PackUrl = myConfig.Install.ModpackUrl
+		// Without the loader install, the version comes from the config or
+		// the manifest
+		if lockfile.McVersion == "" {
+			lockfile.McVersion = p.GetMCVersion()
+		}
 		lockfile.Write(myConfig.Install.BaseInstallPath)
 
-		// Install loader if needed
-		if myConfig.Install.InstallLoader {
-			forgeVersion := p.GetForgeVersion()
-			mcVersion := p.GetMCVersion()
-			loaderManager.installLoader(forgeVersion, mcVersion, myConfig.Install.InstallerArguments)
+		// Keep the backup of the previous install
+		if err := p.Commit(); err != nil {
+			log.Error(err)
+		}
+
+		// Enable rcon if requested
+		if myConfig.Install.Rcon.Configure {
+			if err := configureRcon(myConfig.Install.BaseInstallPath, myConfig.Install.Rcon); err != nil {
+				log.Error(err)
+			}
 		}
 	} else {
 		log.Info("Server is already installed to correct version, to force install delete the serverstarter.lock File.")
 	}
 
+	// Lockfiles of installs without the loader have no version, the java
+	// check needs one
+	if lockfile.McVersion == "" {
+		lockfile.McVersion = myConfig.Install.MCVersion
+	}
+
 	// Start server handler
-	loaderManager.handleServer()
+	if err := loaderManager.handleServer(); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const mebibyte = 1024 * 1024
+
+// Memory of a container left to the JVM outside the heap, for metaspace,
+// thread stacks and direct buffers
+const (
+	memoryHeadroomRatio = 0.2
+	minMemoryHeadroom   = 512 * mebibyte
+)
+
+// parseMemorySize parses sizes like 4G, 4096M or 4GB. A value ending in %
+// is returned as a fraction with percent set.
+func parseMemorySize(value string) (size int64, fraction float64, percent bool, err error) {
+	value = strings.TrimSpace(value)
+	if strings.HasSuffix(value, "%") {
+		fraction, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || fraction <= 0 || fraction > 100 {
+			return 0, 0, false, fmt.Errorf("invalid memory percentage %q", value)
+		}
+		return 0, fraction / 100, true, nil
+	}
+
+	number := strings.TrimSuffix(strings.ToUpper(value), "B")
+	multiplier := int64(1)
+	if number != "" {
+		switch number[len(number)-1] {
+		case 'K':
+			multiplier = 1024
+		case 'M':
+			multiplier = mebibyte
+		case 'G':
+			multiplier = 1024 * mebibyte
+		case 'T':
+			multiplier = 1024 * 1024 * mebibyte
+		}
+		if multiplier != 1 {
+			number = number[:len(number)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, 0, false, fmt.Errorf("invalid memory size %q", value)
+	}
+	return n * multiplier, 0, false, nil
+}
+
+// heapForLimit is the heap fitting into a memory limit with the headroom
+// left to the JVM. Small limits get at least half of the memory, less is no
+// usable heap.
+func heapForLimit(limit int64) int64 {
+	headroom := int64(float64(limit) * memoryHeadroomRatio)
+	if headroom < minMemoryHeadroom {
+		headroom = minMemoryHeadroom
+	}
+	heap := limit - headroom
+	if heap < limit/2 {
+		heap = limit / 2
+	}
+	return heap
+}
+
+// memoryArgs turns launch.maxRam into -Xmx and -Xms. Inside a container with
+// a memory limit the heap is sized from the limit, minus some headroom.
+func (l *loaderManager) memoryArgs() ([]string, error) {
+	for _, arg := range l.launchConfig.JavaArgs {
+		if strings.HasPrefix(arg, "-Xmx") {
+			if l.launchConfig.MaxRam != "" {
+				log.Warnf("javaArgs already sets %s, maxRam %s is ignored", arg, l.launchConfig.MaxRam)
+			}
+			return nil, nil
+		}
+	}
+
+	limit, limited := cgroupMemoryLimit()
+	var heapLimit int64
+	if limited {
+		heapLimit = heapForLimit(limit)
+	}
+
+	var heap int64
+	switch {
+	case l.launchConfig.MaxRam == "" && !limited:
+		return nil, nil
+	case l.launchConfig.MaxRam == "":
+		heap = heapLimit
+		log.Infof("Memory limit of %dM, using %dM for the heap", limit/mebibyte, heap/mebibyte)
+	default:
+		size, fraction, percent, err := parseMemorySize(l.launchConfig.MaxRam)
+		if err != nil {
+			return nil, fmt.Errorf("maxRam: %v", err)
+		}
+		heap = size
+
+		if percent {
+			total := limit
+			if !limited {
+				total, err = physicalMemory()
+				if err != nil {
+					// Let the JVM work it out itself
+					log.Warnf("Could not determine the system memory: %v", err)
+					return []string{fmt.Sprintf("-XX:MaxRAMPercentage=%g", fraction*100)}, nil
+				}
+			}
+			heap = int64(float64(total) * fraction)
+		}
+
+		if limited && heap > heapLimit {
+			log.Warnf("maxRam %s does not fit into the memory limit of %dM, using %dM for the heap", l.launchConfig.MaxRam, limit/mebibyte, heapLimit/mebibyte)
+			heap = heapLimit
+		}
+	}
+
+	heapSize := fmt.Sprintf("%dM", heap/mebibyte)
+	return []string{"-Xmx" + heapSize, "-Xms" + heapSize}, nil
+}
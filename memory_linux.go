@@ -0,0 +1,113 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupMemoryLimit returns the memory limit of the cgroup the starter runs
+// in, for cgroup v2 and v1
+func cgroupMemoryLimit() (int64, bool) {
+	v2Path, v1Path := ownCgroups()
+
+	var candidates []string
+	if v2Path != "" {
+		candidates = append(candidates,
+			filepath.Join("/sys/fs/cgroup", v2Path, "memory.max"),
+			"/sys/fs/cgroup/memory.max")
+	}
+	if v1Path != "" {
+		candidates = append(candidates, filepath.Join("/sys/fs/cgroup/memory", v1Path, "memory.limit_in_bytes"))
+	}
+	// Inside a container the own cgroup is usually mounted as the root
+	candidates = append(candidates, "/sys/fs/cgroup/memory/memory.limit_in_bytes")
+
+	physical, physicalErr := physicalMemory()
+	for _, path := range candidates {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "max" {
+			return 0, false
+		}
+		limit, parseErr := strconv.ParseInt(value, 10, 64)
+		if parseErr != nil || limit <= 0 {
+			continue
+		}
+		// cgroup v1 reports a huge number if there is no limit
+		if physicalErr == nil && limit >= physical {
+			return 0, false
+		}
+		return limit, true
+	}
+
+	return 0, false
+}
+
+// ownCgroups reads the cgroup v2 path and the v1 memory controller path of
+// the starter from /proc/self/cgroup
+func ownCgroups() (string, string) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+
+	v2Path := ""
+	v1Path := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			v2Path = parts[2]
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "memory" {
+				v1Path = parts[2]
+			}
+		}
+	}
+
+	return v2Path, v1Path
+}
+
+func physicalMemory() (int64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// MemTotal:        6158152 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb * 1024, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, errors.New("no MemTotal in /proc/meminfo")
+}
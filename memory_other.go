@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// Memory limits of containers are only known on Linux
+func cgroupMemoryLimit() (int64, bool) {
+	return 0, false
+}
+
+func physicalMemory() (int64, error) {
+	return 0, errors.New("not supported on this system")
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestParseMemorySize(t *testing.T) {
+	tests := []struct {
+		value    string
+		size     int64
+		fraction float64
+		percent  bool
+	}{
+		{"4G", 4096 * mebibyte, 0, false},
+		{"4096M", 4096 * mebibyte, 0, false},
+		{"4GB", 4096 * mebibyte, 0, false},
+		{"512m", 512 * mebibyte, 0, false},
+		{"1024K", mebibyte, 0, false},
+		{"1048576", mebibyte, 0, false},
+		{" 75% ", 0, 0.75, true},
+	}
+	for _, test := range tests {
+		size, fraction, percent, err := parseMemorySize(test.value)
+		if err != nil {
+			t.Errorf("%q: %v", test.value, err)
+			continue
+		}
+		if size != test.size || fraction != test.fraction || percent != test.percent {
+			t.Errorf("%q: got %d, %g, %v, want %d, %g, %v", test.value, size, fraction, percent, test.size, test.fraction, test.percent)
+		}
+	}
+
+	for _, value := range []string{"", "G", "-1G", "0M", "4X", "abc", "0%", "101%", "%"} {
+		if _, _, _, err := parseMemorySize(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestHeapForLimit(t *testing.T) {
+	tests := []struct {
+		limit int64
+		heap  int64
+	}{
+		{256 * mebibyte, 128 * mebibyte},
+		{512 * mebibyte, 256 * mebibyte},
+		{600 * mebibyte, 300 * mebibyte},
+		// 20% headroom is more than the minimum
+		{4096 * mebibyte, 4096*mebibyte - 4096*mebibyte/5},
+	}
+	for _, test := range tests {
+		if heap := heapForLimit(test.limit); heap != test.heap {
+			t.Errorf("limit %dM: got %dM, want %dM", test.limit/mebibyte, heap/mebibyte, test.heap/mebibyte)
+		}
+	}
+}
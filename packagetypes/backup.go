@@ -0,0 +1,255 @@
+package packagetypes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Strange-Account/go-mc-server-starter/config"
+	"github.com/Strange-Account/go-mc-server-starter/utils"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const backupInfoFile = "backup.yaml"
+const backupTimeFormat = "2006-01-02_15-04-05"
+
+// Stored in every backup so it can be restored later
+type backupInfo struct {
+	Created  time.Time       `yaml:"created"`
+	Paths    []string        `yaml:"paths"`
+	LockFile config.LockFile `yaml:"lockfile"`
+}
+
+// Backup is a previous install kept in the backup directory
+type Backup struct {
+	Name       string
+	Path       string
+	Compressed bool
+}
+
+func backupsPath(basePath string, cfg config.BackupConfig) string {
+	if filepath.IsAbs(cfg.Path) {
+		return cfg.Path
+	}
+	return filepath.Join(basePath, cfg.Path)
+}
+
+// ListBackups returns all backups of an install, oldest first
+func ListBackups(basePath string, cfg config.BackupConfig) ([]Backup, error) {
+	var backups []Backup
+
+	dir := backupsPath(basePath, cfg)
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return backups, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		b := Backup{Name: entry.Name(), Path: filepath.Join(dir, entry.Name())}
+		if !entry.IsDir() {
+			if filepath.Ext(b.Name) != ".zip" {
+				continue
+			}
+			b.Name = strings.TrimSuffix(b.Name, ".zip")
+			b.Compressed = true
+		}
+		if len(b.Name) < len(backupTimeFormat) {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, b.Name[:len(backupTimeFormat)]); err != nil {
+			continue
+		}
+		backups = append(backups, b)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name < backups[j].Name
+	})
+
+	return backups, nil
+}
+
+// Pick the name for a new backup, it is never the name of an existing one
+func nextBackupName(basePath string, cfg config.BackupConfig) string {
+	dir := backupsPath(basePath, cfg)
+	base := time.Now().Format(backupTimeFormat)
+
+	name := base
+	for i := 1; ; i++ {
+		_, errDir := os.Stat(filepath.Join(dir, name))
+		_, errZip := os.Stat(filepath.Join(dir, name+".zip"))
+		if os.IsNotExist(errDir) && os.IsNotExist(errZip) {
+			return name
+		}
+		name = fmt.Sprintf("%s.%d", base, i)
+	}
+}
+
+// Create a new backup and move the given paths of the current install into it
+func backupOldFiles(basePath string, cfg config.BackupConfig, paths []string) (*installTransaction, error) {
+	backupPath := filepath.Join(backupsPath(basePath, cfg), nextBackupName(basePath, cfg))
+	log.Infof("Backing up %s to %s", strings.Join(paths, ", "), backupPath)
+
+	err := os.MkdirAll(backupPath, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	lockfile := config.NewLockFile()
+	lockfile.Read(basePath)
+
+	info := backupInfo{
+		Created:  time.Now(),
+		Paths:    paths,
+		LockFile: *lockfile,
+	}
+	data, err := yaml.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(filepath.Join(backupPath, backupInfoFile), data, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	t := newInstallTransaction(basePath, backupPath, paths)
+	for _, p := range paths {
+		if _, err := os.Lstat(filepath.Join(basePath, p)); os.IsNotExist(err) {
+			continue
+		}
+		err = t.backup(p)
+		if err != nil {
+			return t, err
+		}
+	}
+
+	return t, nil
+}
+
+// Compress the finished backup if wanted and drop old ones
+func finishBackup(basePath string, cfg config.BackupConfig, backupPath string) error {
+	if cfg.Compress {
+		err := utils.Zip(backupPath, backupPath+".zip")
+		if err != nil {
+			return err
+		}
+		err = os.RemoveAll(backupPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return pruneBackups(basePath, cfg)
+}
+
+func pruneBackups(basePath string, cfg config.BackupConfig) error {
+	if cfg.Keep <= 0 {
+		return nil
+	}
+
+	backups, err := ListBackups(basePath, cfg)
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > cfg.Keep {
+		log.Infof("Removing old backup %s", backups[0].Name)
+		err = os.RemoveAll(backups[0].Path)
+		if err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// RestoreBackup puts a previous install back in place. The current files are
+// backed up first, the lockfile of the restored install is returned.
+func RestoreBackup(basePath string, cfg config.BackupConfig, name string) (*config.LockFile, error) {
+	backups, err := ListBackups(basePath, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSuffix(filepath.Base(name), ".zip")
+	var backup *Backup
+	for i := range backups {
+		if backups[i].Name == name {
+			backup = &backups[i]
+		}
+	}
+	if backup == nil {
+		return nil, fmt.Errorf("backup %s not found in %s", name, backupsPath(basePath, cfg))
+	}
+
+	stagingPath := filepath.Join(basePath, stagingDirName)
+	os.RemoveAll(stagingPath)
+	defer os.RemoveAll(stagingPath)
+
+	log.Infof("Reading backup %s", backup.Name)
+	if backup.Compressed {
+		absStagingPath, err := filepath.Abs(stagingPath)
+		if err != nil {
+			return nil, err
+		}
+		_, err = utils.Unzip(backup.Path, absStagingPath)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err = utils.CopyDir(backup.Path, stagingPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	infoPath := filepath.Join(stagingPath, backupInfoFile)
+	data, err := ioutil.ReadFile(infoPath)
+	if err != nil {
+		return nil, err
+	}
+	info := backupInfo{}
+	err = yaml.Unmarshal(data, &info)
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(infoPath)
+
+	log.Info("Backup current files")
+	t, err := backupOldFiles(basePath, cfg, info.Paths)
+	if err != nil {
+		if t != nil {
+			t.rollback()
+		}
+		return nil, err
+	}
+
+	log.Info("Moving backup into place")
+	err = t.swap(stagingPath)
+	if err != nil {
+		t.rollback()
+		return nil, err
+	}
+
+	lockfile := info.LockFile
+	err = lockfile.Write(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = finishBackup(basePath, cfg, t.backupPath)
+	if err != nil {
+		log.Error(err)
+	}
+
+	return &lockfile, nil
+}
@@ -2,19 +2,19 @@ package packagetypes
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Strange-Account/go-mc-server-starter/config"
 	"github.com/Strange-Account/go-mc-server-starter/utils"
-	"github.com/gobwas/glob"
 	"github.com/remeh/sizedwaitgroup"
 	log "github.com/sirupsen/logrus"
 )
@@ -41,6 +41,7 @@ type cursePackType struct {
 	forgeVersion string
 	mcVersion    string
 	basePath     string
+	transaction  *installTransaction
 }
 
 func (p *cursePackType) GetForgeVersion() string {
@@ -51,238 +52,448 @@ func (p *cursePackType) GetMCVersion() string {
 	return p.mcVersion
 }
 
-func (p *cursePackType) InstallPack() {
-	if p.config.Install.ModpackUrl != "" {
-		url := p.config.Install.ModpackUrl
-		os.MkdirAll(p.basePath, os.ModePerm)
+// InstallPack builds the new install in a staging directory and only moves
+// it into basePath once every download succeeded
+func (p *cursePackType) InstallPack() error {
+	// Without a pack nothing is staged, the files in place stay untouched
+	if p.config.Install.ModpackUrl == "" {
+		return nil
+	}
 
-		log.Info("Backup old files")
-		backupOldFiles(p.basePath)
+	err := os.MkdirAll(p.basePath, os.ModePerm)
+	if err != nil {
+		return err
+	}
 
-		downloadPack(p.basePath, url)
+	stagingPath := filepath.Join(p.basePath, stagingDirName)
+	os.RemoveAll(stagingPath)
+	defer os.RemoveAll(stagingPath)
 
-		log.Info("Processing Modpack")
-		processModPack(p.basePath, p.config.Install.IgnoreFiles)
+	packPath := filepath.Join(stagingPath, "pack")
+	rootPath := filepath.Join(stagingPath, "root")
+	err = os.MkdirAll(rootPath, os.ModePerm)
+	if err != nil {
+		return err
+	}
 
-		log.Info("Processing manifest")
-		mcVersion, forgeVersion, mods := processManifest(p.basePath, p.config.Install.FormatSpecific.IgnoreProject)
+	ignore, err := utils.NewIgnoreMatcher(p.config.Install.IgnoreFiles)
+	if err != nil {
+		return err
+	}
 
-		if p.mcVersion == "" {
-			p.mcVersion = mcVersion
-		}
+	err = downloadPack(packPath, p.config.Install.ModpackUrl)
+	if err != nil {
+		return err
+	}
 
-		if p.forgeVersion == "" {
-			p.forgeVersion = forgeVersion
-		}
+	manifest, err := readManifest(packPath)
+	if err != nil {
+		return err
+	}
 
-		log.Info("Downloading mods")
-		downloadMods(p.basePath, mods, p.config.Install.IgnoreFiles)
+	log.Info("Processing Modpack")
+	err = processModPack(packPath, manifest.OverridesDir(), rootPath, ignore)
+	if err != nil {
+		return err
 	}
-}
 
-func backupOldFiles(basePath string) {
-	oldFilesPath := filepath.Join(basePath, "OLD_FILES_TO_DELETE")
-	modsPath := filepath.Join(basePath, "mods")
-	configPath := filepath.Join(basePath, "config")
-	kubeJSPath := filepath.Join(basePath, "kubejs")
+	log.Info("Processing manifest")
+	mcVersion, forgeVersion, mods := processManifest(manifest, p.config.Install.FormatSpecific.IgnoreProject)
+
+	if p.mcVersion == "" {
+		p.mcVersion = mcVersion
+	}
+
+	if p.forgeVersion == "" {
+		p.forgeVersion = forgeVersion
+	}
 
-	err := os.RemoveAll(oldFilesPath)
+	log.Info("Downloading mods")
+	err = downloadMods(rootPath, mods, ignore)
 	if err != nil {
-		log.Error(err)
+		return err
 	}
 
-	err = os.MkdirAll(oldFilesPath, os.ModePerm)
+	ignore.Report()
+
+	log.Info("Backup old files")
+	p.transaction, err = backupOldFiles(p.basePath, p.config.Install.Backup, p.config.Install.Backup.Paths)
 	if err != nil {
-		log.Error(err)
+		p.Rollback()
+		return err
 	}
 
-	err = os.Rename(modsPath, filepath.Join(oldFilesPath, "mods"))
+	log.Info("Moving new files into place")
+	err = p.transaction.swap(rootPath)
 	if err != nil {
-		log.Error(err)
+		p.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+// Commit finishes the backup once the whole install succeeded
+func (p *cursePackType) Commit() error {
+	if p.transaction == nil {
+		return nil
 	}
 
-	err = os.Rename(configPath, filepath.Join(oldFilesPath, "config"))
+	backupPath := p.transaction.backupPath
+	p.transaction = nil
+	return finishBackup(p.basePath, p.config.Install.Backup, backupPath)
+}
+
+// Rollback puts the files of the previous install back in place
+func (p *cursePackType) Rollback() {
+	if p.transaction == nil {
+		return
+	}
+
+	log.Warn("Rolling back install")
+	err := p.transaction.rollback()
 	if err != nil {
 		log.Error(err)
 	}
+	p.transaction = nil
+}
 
-	err = os.Rename(kubeJSPath, filepath.Join(oldFilesPath, "kubejs"))
+// Plan resolves the pack like InstallPack does, but only records what would happen
+func (p *cursePackType) Plan() (*Plan, error) {
+	plan := &Plan{
+		Name:    p.config.Modpack.Name,
+		PackUrl: p.config.Install.ModpackUrl,
+	}
+
+	ignore, err := utils.NewIgnoreMatcher(p.config.Install.IgnoreFiles)
 	if err != nil {
-		log.Error(err)
+		return nil, err
+	}
+
+	if p.config.Install.ModpackUrl != "" {
+		tempDir, err := ioutil.TempDir("", "serverstarter-plan")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tempDir)
+
+		err = planBackup(plan, p.basePath, p.config.Install.Backup)
+		if err != nil {
+			return nil, err
+		}
+
+		url := p.config.Install.ModpackUrl
+		plan.Add(ActionDownload, url, "modpack-download.zip", "")
+		modpackPath := filepath.Join(tempDir, "modpack-download.zip")
+		log.Infof("Attempting to download modpack Zip from %s.", url)
+		if err := utils.DownloadFile(modpackPath, url); err != nil {
+			return nil, err
+		}
+		if _, err := utils.Unzip(modpackPath, tempDir); err != nil {
+			return nil, err
+		}
+
+		manifest, err := readManifest(tempDir)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := planOverrides(plan, tempDir, manifest.OverridesDir(), p.basePath, ignore); err != nil {
+			return nil, err
+		}
+		mcVersion, forgeVersion := manifestVersions(manifest)
+		if p.mcVersion == "" {
+			p.mcVersion = mcVersion
+		}
+		if p.forgeVersion == "" {
+			p.forgeVersion = forgeVersion
+		}
+
+		var mods []Files
+		for _, modFile := range manifest.Files {
+			if ok, _ := in_array(modFile.ProjectID, p.config.Install.FormatSpecific.IgnoreProject); ok {
+				plan.Add(ActionSkip, fmt.Sprintf("project %d file %d", modFile.ProjectID, modFile.FileID), "", "ignoreProject")
+				continue
+			}
+			mods = append(mods, modFile)
+		}
+
+		log.Info("Resolving mods")
+		downloadUrls, err := resolveModUrls(mods)
+		if err != nil {
+			return nil, err
+		}
+		for _, url := range downloadUrls {
+			dest := path.Join("mods", path.Base(url))
+			if rule, ignored := ignore.Match(dest); ignored {
+				plan.Add(ActionSkip, url, dest, "ignoreFiles: "+rule)
+			} else {
+				plan.Add(ActionDownload, url, dest, "")
+			}
+		}
+	}
+
+	// Listed so they do not go unnoticed, installs do not download them
+	for _, file := range p.config.Install.AdditionalFiles {
+		if rule, ignored := ignore.Match(file.Destination); ignored {
+			plan.Add(ActionSkip, file.Url, file.Destination, "ignoreFiles: "+rule)
+		} else {
+			plan.Add(ActionSkip, file.Url, file.Destination, "additionalFiles are not downloaded by installs")
+		}
 	}
+
+	plan.MCVersion = p.mcVersion
+	plan.LoaderVersion = p.forgeVersion
+
+	return plan, nil
 }
 
-func downloadPack(basePath string, url string) {
+func planBackup(plan *Plan, basePath string, cfg config.BackupConfig) error {
+	backupPath := filepath.Join(cfg.Path, nextBackupName(basePath, cfg))
+	reason := ""
+	if cfg.Compress {
+		reason = "compressed"
+	}
 
-	log.Infof("Attempting to download modpack Zip from %s.", url)
-	modpackPath := filepath.Join(basePath, "modpack-download.zip")
-	utils.DownloadFile(modpackPath, url)
+	for _, p := range cfg.Paths {
+		if _, err := os.Lstat(filepath.Join(basePath, p)); err == nil {
+			plan.Add(ActionBackup, p, filepath.Join(backupPath, p), reason)
+		}
+	}
 
-	log.Infof("Unpacking modpack to %s", basePath)
-	absBasePath, err := filepath.Abs(basePath)
+	backups, err := ListBackups(basePath, cfg)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	_, err = utils.Unzip(modpackPath, absBasePath)
+	if cfg.Keep > 0 {
+		for i := 0; i < len(backups)+1-cfg.Keep; i++ {
+			plan.Add(ActionDelete, "", filepath.Join(cfg.Path, filepath.Base(backups[i].Path)), "old backup")
+		}
+	}
+
+	return nil
+}
+
+func downloadPack(packPath string, url string) error {
+	err := os.MkdirAll(packPath, os.ModePerm)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+
+	log.Infof("Attempting to download modpack Zip from %s.", url)
+	modpackPath := filepath.Join(packPath, "modpack-download.zip")
+	err = utils.DownloadFile(modpackPath, url)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Unpacking modpack to %s", packPath)
+	absPackPath, err := filepath.Abs(packPath)
+	if err != nil {
+		return err
+	}
+	_, err = utils.Unzip(modpackPath, absPackPath)
+	return err
 }
 
-func processModPack(basePath string, ignoreFiles []string) {
-	var globs []glob.Glob
+// Call fn for every file in the overrides directory of the pack, dest is
+// the path of the file relative to the overrides root
+func walkOverrides(packPath string, overridesDir string, fn func(path string, dest string) error) error {
+	overridesPath := filepath.Join(packPath, filepath.FromSlash(overridesDir))
 
-	log.Info("Processing overrides")
+	rel, err := filepath.Rel(packPath, overridesPath)
+	if err != nil {
+		return err
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return fmt.Errorf("overrides directory %s is not inside the pack", overridesDir)
+	}
 
-	for _, ignoreFile := range ignoreFiles {
-		globs = append(globs, glob.MustCompile(ignoreFile))
+	if _, err := os.Stat(overridesPath); os.IsNotExist(err) {
+		log.Infof("Pack has no %s directory", overridesDir)
+		return nil
 	}
 
-	overridesPath := filepath.Join(basePath, "overrides")
-	err := filepath.Walk(overridesPath,
+	return filepath.Walk(overridesPath,
 		func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
-			if path == "overrides" || info.IsDir() {
+			if info.IsDir() {
 				return nil
 			}
-			dest := path[10:]
-			for _, g := range globs {
-				if g.Match(dest) {
-					log.Infof("Skipping file: %s", dest)
-					return nil
-				}
+			dest, err := filepath.Rel(overridesPath, path)
+			if err != nil {
+				return err
+			}
+			return fn(path, dest)
+		})
+}
+
+// Move the pack overrides into the install tree at rootPath
+func processModPack(packPath string, overridesDir string, rootPath string, ignore *utils.IgnoreMatcher) error {
+	log.Infof("Processing overrides from %s", overridesDir)
+
+	return walkOverrides(packPath, overridesDir,
+		func(path string, dest string) error {
+			if ignore.Skip(dest) {
+				return nil
 			}
 			log.Infof("Moving file: %s", dest)
-			destFolder := filepath.Dir(dest)
-			err = os.MkdirAll(destFolder, os.ModePerm)
+			destPath := filepath.Join(rootPath, dest)
+			err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm)
 			if err != nil {
 				return err
 			}
-			err = os.Rename(path, dest)
-			return err
+			return os.Rename(path, destPath)
 		})
-	if err != nil {
-		log.Error(err)
-	}
-
-	log.Info("Remove override directory")
-	os.RemoveAll(overridesPath)
 }
 
-func processManifest(basePath string, ignoreProjects []int) (mcVersion, forgeVersion string, mods []Files) {
-
-	mods = []Files{}
+func planOverrides(plan *Plan, packPath string, overridesDir string, basePath string, ignore *utils.IgnoreMatcher) error {
+	return walkOverrides(packPath, overridesDir,
+		func(path string, dest string) error {
+			source := filepath.Join(overridesDir, dest)
+			if rule, ignored := ignore.Match(dest); ignored {
+				plan.Add(ActionSkip, source, dest, "ignoreFiles: "+rule)
+				return nil
+			}
+			if _, err := os.Stat(filepath.Join(basePath, dest)); err == nil {
+				plan.Add(ActionReplace, source, dest, "")
+			} else {
+				plan.Add(ActionExtract, source, dest, "")
+			}
+			return nil
+		})
+}
 
+func readManifest(basePath string) (*Manifest, error) {
 	manifestFile := filepath.Join(basePath, "manifest.json")
 	log.Infof("Reading manifest file: %s", manifestFile)
-	jsonFile, err := os.Open(manifestFile)
+	byteValue, err := ioutil.ReadFile(manifestFile)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	defer jsonFile.Close()
 
 	log.Info("Decoding manifest")
-	manifest := Manifest{}
-	byteValue, _ := ioutil.ReadAll(jsonFile)
-	json.Unmarshal(byteValue, &manifest)
+	manifest := &Manifest{}
+	if err := json.Unmarshal(byteValue, manifest); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
 
+func manifestVersions(manifest *Manifest) (mcVersion, forgeVersion string) {
 	mcVersion = manifest.Minecraft.Version
 	if len(manifest.Minecraft.ModLoaders) > 0 {
 		forgeVersion = manifest.Minecraft.ModLoaders[0].Id[6:]
 	}
+	return mcVersion, forgeVersion
+}
+
+func processManifest(manifest *Manifest, ignoreProjects []int) (mcVersion, forgeVersion string, mods []Files) {
+
+	mods = []Files{}
+
+	mcVersion, forgeVersion = manifestVersions(manifest)
 
 	for _, modFile := range manifest.Files {
 		ok, _ := in_array(modFile.ProjectID, ignoreProjects)
 		if !ok {
-			log.Debug("Adding project %d - file %d to file list", modFile.ProjectID, modFile.FileID)
+			log.Debugf("Adding project %d - file %d to file list", modFile.ProjectID, modFile.FileID)
 			mods = append(mods, modFile)
 		} else {
-			log.Debug("Skipping project %d - file %d", modFile.ProjectID, modFile.FileID)
+			log.Debugf("Skipping project %d - file %d", modFile.ProjectID, modFile.FileID)
 		}
 	}
 
 	return mcVersion, forgeVersion, mods
 }
 
-func downloadMods(basePath string, mods []Files, ignoreFiles []string) {
+func downloadMods(basePath string, mods []Files, ignore *utils.IgnoreMatcher) error {
+	err := os.MkdirAll(filepath.Join(basePath, "mods"), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	downloadsUrls, err := resolveModUrls(mods)
+	if err != nil {
+		return err
+	}
+
+	var mutex sync.Mutex
+	var downloadErr error
+
+	swg := sizedwaitgroup.New(5)
+	for i, mod := range downloadsUrls {
+		modName := path.Base(mod)
+
+		if !ignore.Skip(path.Join("mods", modName)) {
+			log.Infof("(%d/%d) Loading mod %s ", i+1, len(mods), modName)
+			swg.Add()
+			go func(url string) {
+				defer swg.Done()
+				err := downloadSingleMod(basePath, url)
+				if err != nil {
+					log.Error(err)
+					mutex.Lock()
+					if downloadErr == nil {
+						downloadErr = err
+					}
+					mutex.Unlock()
+				}
+			}(mod)
+		}
+	}
+
+	swg.Wait()
+
+	return downloadErr
+}
+
+// Look up the download url of every mod file
+func resolveModUrls(mods []Files) ([]string, error) {
 	var downloadsUrls []string
 
-	os.MkdirAll(filepath.Join(basePath, "mods"), os.ModePerm)
+	spaceClient := http.Client{
+		Timeout: time.Second * 2, // Timeout after 2 seconds
+	}
 
 	for _, modFile := range mods {
 		url := "https://cursemeta.dries007.net/" +
 			strconv.Itoa(modFile.ProjectID) + "/" + strconv.Itoa(modFile.FileID) + ".json"
 		// log.Printf("Download url is: %s\n", url)
 
-		spaceClient := http.Client{
-			Timeout: time.Second * 2, // Timeout after 2 seconds
-		}
 		req, err := http.NewRequest(http.MethodGet, url, nil)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-		res, getErr := spaceClient.Do(req)
-		if getErr != nil {
-			log.Fatal(getErr)
+		res, err := spaceClient.Do(req)
+		if err != nil {
+			return nil, err
 		}
 
-		if res.Body != nil {
-			defer res.Body.Close()
-		}
-		body, readErr := ioutil.ReadAll(res.Body)
-		if readErr != nil {
-			log.Fatal(readErr)
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
 		}
 		var result map[string]interface{}
-		json.Unmarshal([]byte(body), &result)
-		downloadsUrls = append(downloadsUrls, result["DownloadURL"].(string))
-	}
-
-	ignorePatterns := []*regexp.Regexp{}
-	for _, ignoreFiles := range ignoreFiles {
-		if strings.HasPrefix(ignoreFiles, "mods/") {
-			pattern, err := regexp.Compile(ignoreFiles[strings.LastIndex(ignoreFiles, "/")+1:])
-			if err != nil {
-				log.Fatal(err)
-			}
-			ignorePatterns = append(ignorePatterns, pattern)
-		}
-	}
-
-	swg := sizedwaitgroup.New(5)
-	for i, mod := range downloadsUrls {
-		modName := path.Base(mod)
-
-		ignored := false
-		for _, ignorePattern := range ignorePatterns {
-			if ignorePattern.MatchString(modName) {
-				ignored = true
-			}
-		}
-
-		if !ignored {
-			log.Infof("(%d/%d) Loading mod %s ", i+1, len(mods), modName)
-			swg.Add()
-			go downloadSingleMod(basePath, mod, &swg)
-		} else {
-			log.Infof("(%d/%d) Skipped ignored mod: %s", i+1, len(mods), modName)
+		json.Unmarshal(body, &result)
+		downloadUrl, ok := result["DownloadURL"].(string)
+		if !ok {
+			return nil, fmt.Errorf("no download url for project %d file %d", modFile.ProjectID, modFile.FileID)
 		}
+		downloadsUrls = append(downloadsUrls, downloadUrl)
 	}
 
-	swg.Wait()
+	return downloadsUrls, nil
 }
 
-func downloadSingleMod(basePath string, url string, swg *sizedwaitgroup.SizedWaitGroup) {
-	defer swg.Done()
-
+func downloadSingleMod(basePath string, url string) error {
 	modName := path.Base(url)
 	destPath := filepath.Join(basePath, "mods", modName)
-	err := utils.DownloadFile(destPath, url)
-	if err != nil {
-		log.Error(err)
-	}
+	return utils.DownloadFile(destPath, url)
 }
 
 func in_array(val int, array []int) (ok bool, i int) {
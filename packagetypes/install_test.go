@@ -0,0 +1,38 @@
+package packagetypes
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Strange-Account/go-mc-server-starter/config"
+)
+
+func TestInstallPackWithoutModpackUrl(t *testing.T) {
+	basePath := t.TempDir()
+	writeTestFiles(t, basePath, map[string]string{
+		"mods/a.jar":      "a",
+		"config/a.cfg":    "cfg",
+		"kubejs/a.js":     "js",
+		"world/level.dat": "level",
+	})
+
+	c := &config.ConfigFile{}
+	c.Install.BaseInstallPath = basePath
+	c.Install.Backup.Path = "backups"
+	c.Install.Backup.Keep = 5
+	c.Install.Backup.Paths = []string{"mods", "config", "kubejs"}
+
+	p := NewCursePack(c)
+	if err := p.InstallPack(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFile(t, filepath.Join(basePath, "mods", "a.jar"), "a")
+	assertFile(t, filepath.Join(basePath, "config", "a.cfg"), "cfg")
+	assertFile(t, filepath.Join(basePath, "kubejs", "a.js"), "js")
+	assertMissing(t, filepath.Join(basePath, "backups"))
+	assertMissing(t, filepath.Join(basePath, stagingDirName))
+}
@@ -8,6 +8,15 @@ type Manifest struct {
 	Version         string    `json:"version"`
 	Author          string    `json:"author"`
 	Files           []Files   `json:"files"`
+	Overrides       string    `json:"overrides"`
+}
+
+// OverridesDir is the pack directory holding the overrides
+func (m *Manifest) OverridesDir() string {
+	if m.Overrides == "" {
+		return "overrides"
+	}
+	return m.Overrides
 }
 
 type Minecraft struct {
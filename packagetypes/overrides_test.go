@@ -0,0 +1,139 @@
+package packagetypes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Strange-Account/go-mc-server-starter/utils"
+)
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func assertFile(t *testing.T, path string, content string) {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected file %s: %v", path, err)
+	}
+	if string(data) != content {
+		t.Errorf("%s: got %q, want %q", path, data, content)
+	}
+}
+
+func assertMissing(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected %s to not exist", path)
+	}
+}
+
+func TestProcessModPackOutsideWorkingDirectory(t *testing.T) {
+	tmp := t.TempDir()
+	packPath := filepath.Join(tmp, "servers", "pack", "staging", "pack")
+	rootPath := filepath.Join(tmp, "servers", "pack", "staging", "root")
+
+	writeTestFiles(t, packPath, map[string]string{
+		"manifest.json":               "{}",
+		"overrides/config/a.cfg":      "a",
+		"overrides/scripts/b/c.zs":    "c",
+		"overrides/server-icon.png":   "icon",
+		"overrides/options.txt":       "ignored",
+		"overrides/mods/local.jar":    "jar",
+		"overrides/mods/excluded.jar": "ignored",
+	})
+
+	ignore, err := utils.NewIgnoreMatcher([]string{"options.txt", "re:^mods/exc.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := processModPack(packPath, "overrides", rootPath, ignore); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFile(t, filepath.Join(rootPath, "config", "a.cfg"), "a")
+	assertFile(t, filepath.Join(rootPath, "scripts", "b", "c.zs"), "c")
+	assertFile(t, filepath.Join(rootPath, "server-icon.png"), "icon")
+	assertFile(t, filepath.Join(rootPath, "mods", "local.jar"), "jar")
+	assertMissing(t, filepath.Join(rootPath, "options.txt"))
+	assertMissing(t, filepath.Join(rootPath, "mods", "excluded.jar"))
+	assertMissing(t, filepath.Join(rootPath, "overrides"))
+	assertMissing(t, filepath.Join(rootPath, "manifest.json"))
+
+	if len(ignore.Skipped()) != 2 {
+		t.Errorf("expected 2 skipped files, got %v", ignore.Skipped())
+	}
+}
+
+func TestProcessModPackCustomOverridesDir(t *testing.T) {
+	tmp := t.TempDir()
+	packPath := filepath.Join(tmp, "pack")
+	rootPath := filepath.Join(tmp, "root")
+
+	writeTestFiles(t, packPath, map[string]string{
+		"manifest.json":          `{"minecraft": {"version": "1.16.5"}, "overrides": "files"}`,
+		"files/config/a.cfg":     "a",
+		"overrides/config/b.cfg": "not used",
+	})
+
+	manifest, err := readManifest(packPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.OverridesDir() != "files" {
+		t.Fatalf("got overrides dir %q, want files", manifest.OverridesDir())
+	}
+
+	ignore, _ := utils.NewIgnoreMatcher(nil)
+	if err := processModPack(packPath, manifest.OverridesDir(), rootPath, ignore); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFile(t, filepath.Join(rootPath, "config", "a.cfg"), "a")
+	assertMissing(t, filepath.Join(rootPath, "config", "b.cfg"))
+	assertMissing(t, filepath.Join(rootPath, "files"))
+}
+
+func TestProcessModPackMissingOverrides(t *testing.T) {
+	tmp := t.TempDir()
+	rootPath := filepath.Join(tmp, "root")
+
+	ignore, _ := utils.NewIgnoreMatcher(nil)
+	if err := processModPack(tmp, "overrides", rootPath, ignore); err != nil {
+		t.Fatal(err)
+	}
+	assertMissing(t, rootPath)
+}
+
+func TestProcessModPackRejectsOverridesOutsidePack(t *testing.T) {
+	tmp := t.TempDir()
+	packPath := filepath.Join(tmp, "pack")
+	writeTestFiles(t, tmp, map[string]string{"secret/file.txt": "x"})
+
+	ignore, _ := utils.NewIgnoreMatcher(nil)
+	for _, dir := range []string{"../secret", ".", ""} {
+		if err := processModPack(packPath, dir, filepath.Join(tmp, "root"), ignore); err == nil {
+			t.Errorf("expected error for overrides dir %q", dir)
+		}
+	}
+}
+
+func TestManifestDefaultOverridesDir(t *testing.T) {
+	m := Manifest{}
+	if m.OverridesDir() != "overrides" {
+		t.Errorf("got %q, want overrides", m.OverridesDir())
+	}
+}
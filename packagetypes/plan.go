@@ -0,0 +1,93 @@
+package packagetypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Kinds of actions an install plan can contain
+const (
+	ActionDownload = "download"
+	ActionExtract  = "extract"
+	ActionReplace  = "replace"
+	ActionDelete   = "delete"
+	ActionSkip     = "skip"
+	ActionBackup   = "backup"
+	ActionRun      = "run"
+)
+
+// Action is a single step an install would perform
+type Action struct {
+	Kind        string `json:"action"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// Plan describes what an install would do without doing it
+type Plan struct {
+	Name          string   `json:"name"`
+	PackUrl       string   `json:"packUrl,omitempty"`
+	MCVersion     string   `json:"mcVersion"`
+	LoaderVersion string   `json:"loaderVersion"`
+	Installed     bool     `json:"installed"`
+	Actions       []Action `json:"actions"`
+}
+
+func (p *Plan) Add(kind string, source string, destination string, reason string) {
+	p.Actions = append(p.Actions, Action{
+		Kind:        kind,
+		Source:      source,
+		Destination: destination,
+		Reason:      reason,
+	})
+}
+
+// Print writes a human readable version of the plan
+func (p *Plan) Print(w io.Writer) {
+	fmt.Fprintf(w, "Plan for %s (Minecraft %s, loader %s)\n", p.Name, p.MCVersion, p.LoaderVersion)
+	if p.Installed {
+		fmt.Fprintln(w, "Server is already installed to correct version, nothing to do.")
+		return
+	}
+
+	counts := map[string]int{}
+	for _, a := range p.Actions {
+		counts[a.Kind]++
+
+		line := fmt.Sprintf("  %-8s", a.Kind)
+		if a.Source != "" {
+			line += " " + a.Source
+		}
+		if a.Source != "" && a.Destination != "" {
+			line += " ->"
+		}
+		if a.Destination != "" {
+			line += " " + a.Destination
+		}
+		if a.Reason != "" {
+			line += " (" + a.Reason + ")"
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	fmt.Fprintf(w, "%d actions:", len(p.Actions))
+	for _, kind := range []string{ActionDownload, ActionExtract, ActionReplace, ActionDelete, ActionSkip, ActionBackup, ActionRun} {
+		if counts[kind] > 0 {
+			fmt.Fprintf(w, " %d %s", counts[kind], kind)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// PrintJSON writes the plan as indented JSON
+func (p *Plan) PrintJSON(w io.Writer) error {
+	if p.Actions == nil {
+		p.Actions = []Action{}
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(p)
+}
@@ -0,0 +1,144 @@
+package packagetypes
+
+import (
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const stagingDirName = ".serverstarter-staging"
+
+// installTransaction keeps track of every path moved during an install,
+// so the previous install can be put back if something fails
+type installTransaction struct {
+	basePath   string
+	backupPath string
+	replaced   []string
+	backedUp   []string
+	installed  []string
+}
+
+// Paths in replaced are swapped as a whole instead of file by file
+func newInstallTransaction(basePath string, backupPath string, replaced []string) *installTransaction {
+	t := installTransaction{}
+	t.basePath = basePath
+	t.backupPath = backupPath
+	t.replaced = replaced
+
+	return &t
+}
+
+// Move a path of the current install into the backup
+func (t *installTransaction) backup(rel string) error {
+	src := filepath.Join(t.basePath, rel)
+	dest := filepath.Join(t.backupPath, rel)
+
+	err := os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(src, dest)
+	if err != nil {
+		return err
+	}
+
+	t.backedUp = append(t.backedUp, rel)
+	return nil
+}
+
+// Move a staged path into the install, backing up whatever was there before
+func (t *installTransaction) install(stagedPath string, rel string) error {
+	dest := filepath.Join(t.basePath, rel)
+
+	if _, err := os.Lstat(dest); err == nil {
+		err = t.backup(rel)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(stagedPath, dest)
+	if err != nil {
+		return err
+	}
+
+	t.installed = append(t.installed, rel)
+	return nil
+}
+
+// swap moves the staged install tree into basePath
+func (t *installTransaction) swap(rootPath string) error {
+	return filepath.Walk(rootPath,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == rootPath {
+				return nil
+			}
+			rel, err := filepath.Rel(rootPath, path)
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return t.install(path, rel)
+			}
+			if t.isReplaced(rel) {
+				err = t.install(path, rel)
+				if err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+			// Other directories are merged file by file
+			return nil
+		})
+}
+
+// rollback removes everything installed and restores the backup
+func (t *installTransaction) rollback() error {
+	var firstErr error
+	keepErr := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for i := len(t.installed) - 1; i >= 0; i-- {
+		log.Debugf("Removing %s", t.installed[i])
+		keepErr(os.RemoveAll(filepath.Join(t.basePath, t.installed[i])))
+	}
+	t.installed = nil
+
+	for i := len(t.backedUp) - 1; i >= 0; i-- {
+		rel := t.backedUp[i]
+		dest := filepath.Join(t.basePath, rel)
+		log.Infof("Restoring %s", rel)
+		keepErr(os.RemoveAll(dest))
+		keepErr(os.MkdirAll(filepath.Dir(dest), os.ModePerm))
+		keepErr(os.Rename(filepath.Join(t.backupPath, rel), dest))
+	}
+	t.backedUp = nil
+
+	if firstErr == nil {
+		keepErr(os.RemoveAll(t.backupPath))
+	}
+
+	return firstErr
+}
+
+func (t *installTransaction) isReplaced(rel string) bool {
+	for _, p := range t.replaced {
+		if filepath.Clean(filepath.FromSlash(p)) == rel {
+			return true
+		}
+	}
+	return false
+}
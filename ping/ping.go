@@ -0,0 +1,187 @@
+package ping
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Protocol version sent in the handshake, servers answer status requests
+// for any version
+const handshakeProtocol = 47
+
+// Responses larger than this are treated as a broken connection
+const maxPacketSize = 1 << 21
+
+// Status is the answer of a server to a Server List Ping
+type Status struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+	} `json:"players"`
+	Latency time.Duration `json:"-"`
+}
+
+// Ping asks the server at address for its status using the Server List Ping
+// protocol of Minecraft 1.7 and newer
+func Ping(address string, timeout time.Duration) (*Status, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// Handshake with next state status, followed by the status request
+	var handshake bytes.Buffer
+	writeVarInt(&handshake, 0x00)
+	writeVarInt(&handshake, handshakeProtocol)
+	writeString(&handshake, host)
+	binary.Write(&handshake, binary.BigEndian, uint16(port))
+	writeVarInt(&handshake, 1)
+
+	err = writePacket(conn, handshake.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	err = writePacket(conn, []byte{0x00})
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	data, err := readPacket(reader, 0x00)
+	if err != nil {
+		return nil, err
+	}
+	response, err := readString(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	status := Status{}
+	err = json.Unmarshal([]byte(response), &status)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ping and pong for the latency
+	var ping bytes.Buffer
+	writeVarInt(&ping, 0x01)
+	sent := time.Now()
+	binary.Write(&ping, binary.BigEndian, sent.UnixNano())
+	err = writePacket(conn, ping.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	_, err = readPacket(reader, 0x01)
+	if err != nil {
+		return nil, err
+	}
+	status.Latency = time.Since(sent)
+
+	return &status, nil
+}
+
+func writePacket(w io.Writer, data []byte) error {
+	var packet bytes.Buffer
+	writeVarInt(&packet, int32(len(data)))
+	packet.Write(data)
+
+	_, err := w.Write(packet.Bytes())
+	return err
+}
+
+// Read a packet and check its id, the data after the id is returned
+func readPacket(r *bufio.Reader, id int32) ([]byte, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if length < 1 || length > maxPacketSize {
+		return nil, fmt.Errorf("invalid packet length %d", length)
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, err
+	}
+
+	dataReader := bytes.NewReader(data)
+	packetID, err := readVarInt(dataReader)
+	if err != nil {
+		return nil, err
+	}
+	if packetID != id {
+		return nil, fmt.Errorf("unexpected packet id %d, expected %d", packetID, id)
+	}
+
+	return data[len(data)-dataReader.Len():], nil
+}
+
+func writeVarInt(w *bytes.Buffer, value int32) {
+	v := uint32(value)
+	for {
+		if v&^0x7F == 0 {
+			w.WriteByte(byte(v))
+			return
+		}
+		w.WriteByte(byte(v&0x7F | 0x80))
+		v >>= 7
+	}
+}
+
+func readVarInt(r io.ByteReader) (int32, error) {
+	var value uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint32(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(value), nil
+		}
+	}
+	return 0, errors.New("varint is too big")
+}
+
+func writeString(w *bytes.Buffer, s string) {
+	writeVarInt(w, int32(len(s)))
+	w.WriteString(s)
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if length < 0 || int(length) > r.Len() {
+		return "", fmt.Errorf("invalid string length %d", length)
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(r, data)
+	return string(data), err
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Strange-Account/go-mc-server-starter/utils"
+)
+
+const mojangProfilesUrl = "https://api.mojang.com/profiles/minecraft"
+
+// The Mojang API resolves at most this many names per request
+const mojangProfilesBatch = 10
+
+// Format of the created field of bans, like 2021-01-02 15:04:05 +0000
+const banTimeFormat = "2006-01-02 15:04:05 -0700"
+
+const (
+	playersMerge   = "merge"
+	playersReplace = "replace"
+)
+
+// playerEntry is an entry of ops.json, whitelist.json or
+// banned-players.json. Fields the starter does not know are kept.
+type playerEntry map[string]interface{}
+
+type playerProfile struct {
+	uuid string
+	name string
+}
+
+// applyPlayers writes the configured operators, whitelist and bans. Lists
+// missing in the config are left alone.
+func (l *loaderManager) applyPlayers() error {
+	players := l.launchConfig.Players
+	if len(players.Ops) == 0 && len(players.Whitelist) == 0 && len(players.Bans) == 0 {
+		return nil
+	}
+	if players.Policy != playersMerge && players.Policy != playersReplace {
+		return fmt.Errorf("unknown players.policy %q, use %s or %s", players.Policy, playersMerge, playersReplace)
+	}
+
+	properties, err := utils.ReadProperties(filepath.Join(l.basePath, "server.properties"))
+	if err != nil {
+		return err
+	}
+	online := properties.GetDefault("online-mode", "true") != "false"
+
+	opsFile := filepath.Join(l.basePath, "ops.json")
+	whitelistFile := filepath.Join(l.basePath, "whitelist.json")
+	bansFile := filepath.Join(l.basePath, "banned-players.json")
+
+	ops, err := readPlayerList(opsFile)
+	if err != nil {
+		return err
+	}
+	whitelist, err := readPlayerList(whitelistFile)
+	if err != nil {
+		return err
+	}
+	bans, err := readPlayerList(bansFile)
+	if err != nil {
+		return err
+	}
+
+	// Names already in the files do not need to be looked up again
+	known := map[string]playerProfile{}
+	for _, list := range [][]playerEntry{ops, whitelist, bans} {
+		for _, entry := range list {
+			name, _ := entry["name"].(string)
+			uuid, _ := entry["uuid"].(string)
+			if name != "" && uuid != "" {
+				known[strings.ToLower(name)] = playerProfile{uuid: uuid, name: name}
+			}
+		}
+	}
+
+	var names []string
+	for _, op := range players.Ops {
+		names = append(names, op.Name)
+	}
+	names = append(names, players.Whitelist...)
+	for _, ban := range players.Bans {
+		names = append(names, ban.Name)
+	}
+	profiles, err := resolvePlayers(names, online, known)
+	if err != nil {
+		return err
+	}
+
+	if len(players.Ops) > 0 {
+		var entries []playerEntry
+		for _, op := range players.Ops {
+			profile, ok := profiles[strings.ToLower(op.Name)]
+			if !ok {
+				continue
+			}
+			level := op.Level
+			if level == 0 {
+				level = 4
+			}
+			entries = append(entries, playerEntry{
+				"uuid":                profile.uuid,
+				"name":                profile.name,
+				"level":               level,
+				"bypassesPlayerLimit": op.BypassesPlayerLimit,
+			})
+		}
+		err = writePlayerList(opsFile, mergePlayers(ops, entries, players.Policy))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(players.Whitelist) > 0 {
+		var entries []playerEntry
+		for _, name := range players.Whitelist {
+			profile, ok := profiles[strings.ToLower(name)]
+			if !ok {
+				continue
+			}
+			entries = append(entries, playerEntry{"uuid": profile.uuid, "name": profile.name})
+		}
+		err = writePlayerList(whitelistFile, mergePlayers(whitelist, entries, players.Policy))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(players.Bans) > 0 {
+		var entries []playerEntry
+		for _, ban := range players.Bans {
+			profile, ok := profiles[strings.ToLower(ban.Name)]
+			if !ok {
+				continue
+			}
+			reason := ban.Reason
+			if reason == "" {
+				reason = "Banned by an operator."
+			}
+			entries = append(entries, playerEntry{
+				"uuid":    profile.uuid,
+				"name":    profile.name,
+				"created": time.Now().Format(banTimeFormat),
+				"source":  "Server",
+				"expires": "forever",
+				"reason":  reason,
+			})
+		}
+		err = writePlayerList(bansFile, mergePlayers(bans, entries, players.Policy))
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info("Updated operators, whitelist and bans from the config")
+	return nil
+}
+
+// mergePlayers combines the entries of a file with the configured ones. The
+// configured entries win, with merge other entries of the file are kept.
+func mergePlayers(existing []playerEntry, configured []playerEntry, policy string) []playerEntry {
+	old := map[string]playerEntry{}
+	for _, entry := range existing {
+		if uuid, ok := entry["uuid"].(string); ok {
+			old[strings.ToLower(uuid)] = entry
+		}
+	}
+
+	var merged []playerEntry
+	seen := map[string]bool{}
+	for _, entry := range configured {
+		uuid := strings.ToLower(entry["uuid"].(string))
+		if seen[uuid] {
+			continue
+		}
+		seen[uuid] = true
+
+		// Keep fields like the original ban date
+		if previous, ok := old[uuid]; ok {
+			if created, ok := previous["created"]; ok && entry["created"] != nil {
+				entry["created"] = created
+			}
+			for key, value := range previous {
+				if _, ok := entry[key]; !ok {
+					entry[key] = value
+				}
+			}
+		}
+		merged = append(merged, entry)
+	}
+
+	if policy == playersMerge {
+		for _, entry := range existing {
+			uuid, _ := entry["uuid"].(string)
+			if !seen[strings.ToLower(uuid)] {
+				merged = append(merged, entry)
+			}
+		}
+	}
+
+	return merged
+}
+
+// resolvePlayers looks up the UUIDs of player names. Offline servers use the
+// UUIDs the server derives from the name itself.
+func resolvePlayers(names []string, online bool, known map[string]playerProfile) (map[string]playerProfile, error) {
+	profiles := map[string]playerProfile{}
+	var unknown []string
+	for _, name := range names {
+		key := strings.ToLower(name)
+		if _, ok := profiles[key]; ok {
+			continue
+		}
+		switch {
+		case !online:
+			profiles[key] = playerProfile{uuid: offlineUUID(name), name: name}
+		case known[key].uuid != "":
+			profiles[key] = known[key]
+		default:
+			profiles[key] = playerProfile{}
+			unknown = append(unknown, name)
+		}
+	}
+
+	for start := 0; start < len(unknown); start += mojangProfilesBatch {
+		end := start + mojangProfilesBatch
+		if end > len(unknown) {
+			end = len(unknown)
+		}
+		found, err := lookupMojangProfiles(unknown[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, profile := range found {
+			profiles[strings.ToLower(profile.name)] = profile
+		}
+	}
+
+	for key, profile := range profiles {
+		if profile.uuid == "" {
+			log.Warnf("Player %s does not exist, skipping it", key)
+			delete(profiles, key)
+		}
+	}
+
+	return profiles, nil
+}
+
+func lookupMojangProfiles(names []string) ([]playerProfile, error) {
+	body, err := json.Marshal(names)
+	if err != nil {
+		return nil, err
+	}
+
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(mojangProfilesUrl, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("looking up players failed: %s", resp.Status)
+	}
+
+	var result []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []playerProfile
+	for _, r := range result {
+		if len(r.ID) != 32 {
+			continue
+		}
+		// The API returns UUIDs without dashes
+		uuid := r.ID[0:8] + "-" + r.ID[8:12] + "-" + r.ID[12:16] + "-" + r.ID[16:20] + "-" + r.ID[20:32]
+		profiles = append(profiles, playerProfile{uuid: uuid, name: r.Name})
+	}
+	return profiles, nil
+}
+
+// offlineUUID is the name based UUID (version 3) offline servers give a
+// player, the same as Java's UUID.nameUUIDFromBytes("OfflinePlayer:" + name)
+func offlineUUID(name string) string {
+	hash := md5.Sum([]byte("OfflinePlayer:" + name))
+	hash[6] = hash[6]&0x0f | 0x30
+	hash[8] = hash[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", hash[0:4], hash[4:6], hash[6:8], hash[8:10], hash[10:16])
+}
+
+func readPlayerList(path string) ([]playerEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []playerEntry
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return entries, nil
+}
+
+func writePlayerList(path string, entries []playerEntry) error {
+	if entries == nil {
+		entries = []playerEntry{}
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
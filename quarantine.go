@@ -0,0 +1,179 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Strange-Account/go-mc-server-starter/config"
+)
+
+// Crash reports name suspected mods as "Name (modid), Version: 1.0"
+var suspectedModIDPattern = regexp.MustCompile(`\(([a-z0-9_.-]+)\)`)
+
+var modsTomlIDPattern = regexp.MustCompile(`(?m)^\s*modId\s*=\s*"([^"]+)"`)
+var mcmodInfoIDPattern = regexp.MustCompile(`"modid"\s*:\s*"([^"]+)"`)
+
+// modQuarantine moves mods out of the way that crash the server during
+// startup again and again
+type modQuarantine struct {
+	basePath string
+	crashes  int
+	path     string
+
+	// Startup crashes in a row blaming each mod id
+	blamed      map[string]int
+	quarantined []string
+}
+
+func newModQuarantine(basePath string, c config.QuarantineConfig) *modQuarantine {
+	q := modQuarantine{}
+	q.basePath = basePath
+	q.crashes = c.Crashes
+	q.path = c.Path
+	q.blamed = map[string]int{}
+
+	return &q
+}
+
+// startupCrashed records the mods blamed for a crash before the server was
+// ready and quarantines the ones blamed too often
+func (q *modQuarantine) startupCrashed(exit serverExit) {
+	blamed := map[string]int{}
+	if exit.report != nil {
+		for _, mod := range exit.report.suspectedMods {
+			for _, match := range suspectedModIDPattern.FindAllStringSubmatch(mod, -1) {
+				blamed[match[1]] = q.blamed[match[1]] + 1
+			}
+		}
+	}
+	// Mods not blamed this time start over
+	q.blamed = blamed
+
+	for modID, count := range blamed {
+		if count < q.crashes {
+			log.Warnf("Mod %s was blamed for %d startup crashes in a row", modID, count)
+			continue
+		}
+
+		jar, err := q.findJar(modID)
+		if err != nil {
+			log.Errorf("Could not search the mods folder for %s: %v", modID, err)
+			continue
+		}
+		if jar == "" {
+			log.Warnf("Mod %s keeps crashing the server, but no jar in the mods folder provides it", modID)
+			continue
+		}
+
+		err = q.move(jar)
+		if err != nil {
+			log.Errorf("Could not quarantine %s: %v", jar, err)
+			continue
+		}
+
+		log.Warnf("Mod %s crashed the startup %d times in a row, moved %s to %s", modID, count, filepath.Base(jar), q.path)
+		q.quarantined = append(q.quarantined, filepath.Base(jar))
+		delete(q.blamed, modID)
+	}
+}
+
+// reset forgets the blame once the server got ready
+func (q *modQuarantine) reset() {
+	q.blamed = map[string]int{}
+}
+
+// report lists the mods quarantined so far
+func (q *modQuarantine) report() {
+	if len(q.quarantined) > 0 {
+		log.Warnf("Quarantined mods, check %s: %s", q.path, strings.Join(q.quarantined, ", "))
+	}
+}
+
+func (q *modQuarantine) move(jar string) error {
+	dir := filepath.Join(q.basePath, q.path)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(jar, filepath.Join(dir, filepath.Base(jar)))
+}
+
+// findJar looks through the jars in the mods folder for the one declaring
+// modID
+func (q *modQuarantine) findJar(modID string) (string, error) {
+	jars, err := filepath.Glob(filepath.Join(q.basePath, "mods", "*.jar"))
+	if err != nil {
+		return "", err
+	}
+
+	for _, jar := range jars {
+		ids, err := jarModIDs(jar)
+		if err != nil {
+			log.Debugf("Could not read mod ids of %s: %v", jar, err)
+			continue
+		}
+		for _, id := range ids {
+			if id == modID {
+				return jar, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// jarModIDs reads the mod ids from the Forge, old Forge and Fabric metadata
+// of a mod jar
+func jarModIDs(path string) ([]string, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var ids []string
+	for _, f := range r.File {
+		switch f.Name {
+		case "META-INF/mods.toml", "mcmod.info", "fabric.mod.json":
+		default:
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		switch f.Name {
+		case "META-INF/mods.toml":
+			for _, match := range modsTomlIDPattern.FindAllSubmatch(data, -1) {
+				ids = append(ids, string(match[1]))
+			}
+		case "mcmod.info":
+			for _, match := range mcmodInfoIDPattern.FindAllSubmatch(data, -1) {
+				ids = append(ids, string(match[1]))
+			}
+		case "fabric.mod.json":
+			var fabricMod struct {
+				ID string `json:"id"`
+			}
+			if json.Unmarshal(data, &fabricMod) == nil && fabricMod.ID != "" {
+				ids = append(ids, fabricMod.ID)
+			}
+		}
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/Strange-Account/go-mc-server-starter/utils"
+)
+
+// Records the sync state of the world between the ram disk and the disk
+const ramDiskStateFile = ".serverstarter-ramdisk"
+
+const (
+	ramDiskSyncing = "syncing"
+	ramDiskSynced  = "synced"
+)
+
+type ramDiskState struct {
+	State   string `yaml:"state"`
+	World   string `yaml:"world"`
+	RamPath string `yaml:"ramPath"`
+}
+
+// ramDisk keeps the world in a tmpfs. The world directory becomes a symlink
+// to it, the copy on disk is kept next to it and synced periodically.
+type ramDisk struct {
+	basePath  string
+	worldPath string
+	diskPath  string
+	ramPath   string
+	// Pauses saving of the server while the world is copied
+	withSavingPaused func(func() error) error
+
+	syncMutex sync.Mutex
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// setupRamDisk copies the world to the ram disk and links it in place
+func (l *loaderManager) setupRamDisk() (*ramDisk, error) {
+	if runtime.GOOS != "linux" {
+		log.Warn("ramDisk is only supported on Linux, keeping the world on disk")
+		return nil, nil
+	}
+	if _, err := exec.LookPath("rsync"); err != nil {
+		return nil, errors.New("ramDisk needs rsync to sync the world back to disk")
+	}
+
+	properties, err := utils.ReadProperties(filepath.Join(l.basePath, "server.properties"))
+	if err != nil {
+		return nil, err
+	}
+	level := properties.GetDefault("level-name", "world")
+
+	r := ramDisk{}
+	r.basePath = l.basePath
+	r.worldPath = filepath.Join(l.basePath, level)
+	r.diskPath = r.worldPath + ".disk"
+	r.withSavingPaused = l.withSavingPaused
+
+	// Every instance gets its own directory on the ram disk
+	absBase, err := filepath.Abs(l.basePath)
+	if err != nil {
+		return nil, err
+	}
+	r.ramPath = filepath.Join(l.launchConfig.RamDiskPath, fmt.Sprintf("serverstarter-%x", sha1.Sum([]byte(absBase))), level)
+
+	err = r.recover()
+	if err != nil {
+		return nil, err
+	}
+
+	// Move the world aside, the disk copy is the one being synced to
+	if _, err := os.Lstat(r.worldPath); err == nil {
+		err = os.Rename(r.worldPath, r.diskPath)
+	} else {
+		err = os.MkdirAll(r.diskPath, os.ModePerm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Copying world %s to ram disk %s", level, r.ramPath)
+	err = os.MkdirAll(r.ramPath, os.ModePerm)
+	if err == nil {
+		err = r.writeState(ramDiskSynced)
+	}
+	if err == nil {
+		err = rsync(r.diskPath, r.ramPath)
+	}
+	if err == nil {
+		err = os.Symlink(r.ramPath, r.worldPath)
+	}
+	if err != nil {
+		r.restore()
+		os.RemoveAll(filepath.Dir(r.ramPath))
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// recover puts the world back from a previous run that did not shut down
+// cleanly, unless its last sync did not finish
+func (r *ramDisk) recover() error {
+	state, err := r.readState()
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return nil
+	}
+
+	if state.State == ramDiskSyncing {
+		return fmt.Errorf("the last sync of the world from the ram disk to %s did not finish, "+
+			"check the world and the ram disk copy in %s, then delete %s",
+			r.diskPath, state.RamPath, filepath.Join(r.basePath, ramDiskStateFile))
+	}
+
+	log.Warn("The previous run did not shut down cleanly, using the world from its last sync")
+	if _, err := os.Stat(state.RamPath); err == nil {
+		log.Warnf("The ram disk copy of that run is left in %s", state.RamPath)
+	}
+	r.restore()
+	if _, err := os.Lstat(r.diskPath); err == nil {
+		return fmt.Errorf("could not restore the world from %s", r.diskPath)
+	}
+	return nil
+}
+
+// start syncs the world back to disk every interval
+func (r *ramDisk) start(interval time.Duration) {
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				err := r.sync()
+				if err != nil {
+					log.Errorf("Syncing the world from the ram disk failed: %v", err)
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// close syncs the world a last time and moves it back on disk
+func (r *ramDisk) close() {
+	if r.stop != nil {
+		close(r.stop)
+		<-r.done
+	}
+
+	err := r.sync()
+	if err != nil {
+		log.Errorf("Syncing the world from the ram disk failed, it is left in %s: %v", r.ramPath, err)
+		return
+	}
+	if r.restore() {
+		os.RemoveAll(filepath.Dir(r.ramPath))
+	}
+}
+
+// sync copies the world from the ram disk to disk. While the server is
+// running, saving is paused so the copy is consistent.
+func (r *ramDisk) sync() error {
+	r.syncMutex.Lock()
+	defer r.syncMutex.Unlock()
+
+	return r.withSavingPaused(func() error {
+		log.Info("Syncing world from the ram disk to disk")
+		err := r.writeState(ramDiskSyncing)
+		if err != nil {
+			return err
+		}
+		err = rsync(r.ramPath, r.diskPath)
+		if err != nil {
+			return err
+		}
+		return r.writeState(ramDiskSynced)
+	})
+}
+
+// restore replaces the symlink with the disk copy of the world
+func (r *ramDisk) restore() bool {
+	if info, err := os.Lstat(r.worldPath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		os.Remove(r.worldPath)
+	}
+	if _, err := os.Lstat(r.worldPath); os.IsNotExist(err) {
+		err = os.Rename(r.diskPath, r.worldPath)
+		if err != nil && !os.IsNotExist(err) {
+			log.Errorf("Could not move the world back from %s: %v", r.diskPath, err)
+			return false
+		}
+	}
+
+	os.Remove(filepath.Join(r.basePath, ramDiskStateFile))
+	return true
+}
+
+func (r *ramDisk) readState() (*ramDiskState, error) {
+	data, err := ioutil.ReadFile(filepath.Join(r.basePath, ramDiskStateFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := ramDiskState{}
+	err = yaml.Unmarshal(data, &state)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (r *ramDisk) writeState(state string) error {
+	data, err := yaml.Marshal(ramDiskState{State: state, World: r.worldPath, RamPath: r.ramPath})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(r.basePath, ramDiskStateFile), data, 0644)
+}
+
+// rsync makes dest an exact copy of src
+func rsync(src string, dest string) error {
+	out, err := exec.Command("rsync", "-a", "--delete", src+"/", dest+"/").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("rsync: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Strange-Account/go-mc-server-starter/config"
+	"github.com/Strange-Account/go-mc-server-starter/rcon"
+	"github.com/Strange-Account/go-mc-server-starter/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultRconPort = 25575
+
+// Enable rcon in server.properties, keeping an existing port and password
+// unless the config sets them
+func configureRcon(basePath string, rconConfig config.RconConfig) error {
+	propertiesFile := filepath.Join(basePath, "server.properties")
+	properties, err := utils.ReadProperties(propertiesFile)
+	if err != nil {
+		return err
+	}
+
+	port := rconConfig.Port
+	if port == 0 {
+		port, err = strconv.Atoi(properties.GetDefault("rcon.port", strconv.Itoa(defaultRconPort)))
+		if err != nil {
+			port = defaultRconPort
+		}
+	}
+
+	password := rconConfig.Password
+	if password == "" {
+		password = properties.GetDefault("rcon.password", "")
+	}
+	if password == "" {
+		b := make([]byte, 16)
+		_, err = rand.Read(b)
+		if err != nil {
+			return err
+		}
+		password = hex.EncodeToString(b)
+		log.Info("Generated a new rcon password")
+	}
+
+	log.Infof("Enabling rcon on port %d", port)
+	properties.Set("enable-rcon", "true")
+	properties.Set("rcon.port", strconv.Itoa(port))
+	properties.Set("rcon.password", password)
+
+	return properties.Write(propertiesFile)
+}
+
+// Connect to the rcon port configured in the server.properties of the instance
+func newRconClient(basePath string) (*rcon.Client, error) {
+	properties, err := utils.ReadProperties(filepath.Join(basePath, "server.properties"))
+	if err != nil {
+		return nil, err
+	}
+
+	if properties.GetDefault("enable-rcon", "false") != "true" {
+		return nil, fmt.Errorf("rcon is not enabled in server.properties")
+	}
+
+	password := properties.GetDefault("rcon.password", "")
+	if password == "" {
+		return nil, fmt.Errorf("rcon.password is not set in server.properties")
+	}
+
+	host := properties.GetDefault("server-ip", "")
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	port := properties.GetDefault("rcon.port", strconv.Itoa(defaultRconPort))
+
+	return rcon.Dial(net.JoinHostPort(host, port), password, 10*time.Second)
+}
+
+// Run a single command over rcon and print the response
+func runRconCommand(basePath string, command string) {
+	if command == "" {
+		log.Fatal("Usage: rcon <command>")
+	}
+
+	client, err := newRconClient(basePath)
+	if err != nil {
+		log.Fatalf("Could not connect to rcon: %v", err)
+	}
+	defer client.Close()
+
+	response, err := client.Command(command)
+	if err != nil {
+		log.Fatalf("Rcon command failed: %v", err)
+	}
+	fmt.Println(response)
+}
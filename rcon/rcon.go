@@ -0,0 +1,168 @@
+package rcon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Packet types of the Source RCON protocol
+const (
+	typeResponse = 0
+	typeCommand  = 2
+	typeAuth     = 3
+	// Answered by the server with an error, marks the end of a response
+	typeEndMarker = 100
+)
+
+// Packets larger than this are treated as a broken connection
+const maxPacketSize = 1 << 20
+
+var ErrAuthFailed = errors.New("rcon authentication failed")
+
+// Client is a connection to the RCON port of a server
+type Client struct {
+	conn    net.Conn
+	timeout time.Duration
+	mutex   sync.Mutex
+	nextID  int32
+}
+
+type packet struct {
+	id   int32
+	kind int32
+	body string
+}
+
+// Dial connects and authenticates with the password
+func Dial(address string, password string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := Client{}
+	c.conn = conn
+	c.timeout = timeout
+	c.nextID = 1
+
+	err = c.auth(password)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) auth(password string) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+
+	id := c.newID()
+	err := c.write(packet{id: id, kind: typeAuth, body: password})
+	if err != nil {
+		return err
+	}
+
+	// Some servers send an empty response before the auth response
+	for {
+		p, err := c.read()
+		if err != nil {
+			return err
+		}
+		if p.kind != typeCommand {
+			continue
+		}
+		if p.id == -1 || p.id != id {
+			return ErrAuthFailed
+		}
+		return nil
+	}
+}
+
+// Command runs a console command and returns its output
+func (c *Client) Command(command string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+
+	id := c.newID()
+	err := c.write(packet{id: id, kind: typeCommand, body: command})
+	if err != nil {
+		return "", err
+	}
+
+	// Long responses are split over several packets, the answer to an
+	// invalid packet shows where the response ends
+	endID := c.newID()
+	err = c.write(packet{id: endID, kind: typeEndMarker})
+	if err != nil {
+		return "", err
+	}
+
+	var response bytes.Buffer
+	for {
+		p, err := c.read()
+		if err != nil {
+			return "", err
+		}
+		if p.id == endID {
+			return response.String(), nil
+		}
+		if p.id == id && p.kind == typeResponse {
+			response.WriteString(p.body)
+		}
+	}
+}
+
+func (c *Client) newID() int32 {
+	id := c.nextID
+	c.nextID++
+	return id
+}
+
+func (c *Client) write(p packet) error {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, int32(4+4+len(p.body)+2))
+	binary.Write(&buf, binary.LittleEndian, p.id)
+	binary.Write(&buf, binary.LittleEndian, p.kind)
+	buf.WriteString(p.body)
+	buf.Write([]byte{0, 0})
+
+	_, err := c.conn.Write(buf.Bytes())
+	return err
+}
+
+func (c *Client) read() (packet, error) {
+	var size int32
+	err := binary.Read(c.conn, binary.LittleEndian, &size)
+	if err != nil {
+		return packet{}, err
+	}
+	if size < 10 || size > maxPacketSize {
+		return packet{}, fmt.Errorf("invalid rcon packet size %d", size)
+	}
+
+	data := make([]byte, size)
+	_, err = io.ReadFull(c.conn, data)
+	if err != nil {
+		return packet{}, err
+	}
+
+	p := packet{}
+	p.id = int32(binary.LittleEndian.Uint32(data[0:4]))
+	p.kind = int32(binary.LittleEndian.Uint32(data[4:8]))
+	p.body = string(bytes.TrimRight(data[8:], "\x00"))
+
+	return p, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The ready line of vanilla and most loaders, servers printing something
+// else need launch.readyPatterns. Older versions add ` or "?"`.
+var defaultReadyPatterns = []string{
+	`Done \(([0-9.,]+)s\)! For help, type "help"`,
+}
+
+// Printed when the server stops on its own, e.g. after /stop in game
+var stopPattern = regexp.MustCompile(`Stopping (the )?server`)
+
+const outOfMemoryMarker = "java.lang.OutOfMemoryError"
+
+func compileReadyPatterns(extra []string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, p := range append(append([]string{}, defaultReadyPatterns...), extra...) {
+		r, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, r)
+	}
+	return patterns, nil
+}
+
+// watchOutput follows the server output. It marks the server ready once a
+// ready pattern shows up, if that does not happen within the ready timeout
+// the server is stopped and the restart loop handles it like a crash.
+// Stop and out of memory messages are recorded for classifyExit.
+func (l *loaderManager) watchOutput(server *serverProcess, lines <-chan string, unsubscribe func()) {
+	defer unsubscribe()
+
+	var timeout <-chan time.Time
+	if l.readyTimeout > 0 {
+		timer := time.NewTimer(l.readyTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		select {
+		case line := <-lines:
+			if strings.Contains(line, outOfMemoryMarker) {
+				server.markOutOfMemory()
+			}
+			if stopPattern.MatchString(line) {
+				server.markStopSeen()
+			}
+			if server.isReady() {
+				continue
+			}
+			for _, pattern := range l.readyPatterns {
+				match := pattern.FindStringSubmatch(line)
+				if match == nil {
+					continue
+				}
+				startup := server.markReady()
+				if len(match) > 1 {
+					log.Infof("Server is ready, startup took %s (server reports %ss)", startup.Round(time.Millisecond), match[1])
+				} else {
+					log.Infof("Server is ready, startup took %s", startup.Round(time.Millisecond))
+				}
+				timeout = nil
+				break
+			}
+		case <-timeout:
+			log.Errorf("Server did not become ready within %s, stopping it", l.readyTimeout)
+			server.markReadyTimeout()
+			go server.shutdown(l.shutdownTimeout, l.killTimeout)
+			timeout = nil
+		case <-server.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Strange-Account/go-mc-server-starter/config"
+)
+
+// Actions once the crash limit is reached
+const (
+	giveUpExit = "exit"
+	giveUpStop = "stop"
+	giveUpHook = "hook"
+)
+
+// restartPolicy decides how long to wait before restarting a crashed server
+// and when to give up
+type restartPolicy struct {
+	initialDelay time.Duration
+	multiplier   float64
+	maxDelay     time.Duration
+	stableUptime time.Duration
+	crashLimit   int
+	giveUp       string
+	hook         string
+
+	crashes int
+}
+
+func newRestartPolicy(crashLimit int, c config.RestartConfig) (*restartPolicy, error) {
+	p := restartPolicy{}
+	p.crashLimit = crashLimit
+	p.multiplier = c.Multiplier
+	p.giveUp = c.GiveUp
+	p.hook = c.Hook
+
+	var err error
+	p.initialDelay, err = time.ParseDuration(c.InitialDelay)
+	if err != nil {
+		return nil, fmt.Errorf("restart.initialDelay: %v", err)
+	}
+	p.maxDelay, err = time.ParseDuration(c.MaxDelay)
+	if err != nil {
+		return nil, fmt.Errorf("restart.maxDelay: %v", err)
+	}
+	p.stableUptime, err = time.ParseDuration(c.StableUptime)
+	if err != nil {
+		return nil, fmt.Errorf("restart.stableUptime: %v", err)
+	}
+
+	if p.multiplier < 1 {
+		return nil, fmt.Errorf("restart.multiplier must be at least 1, got %g", p.multiplier)
+	}
+	switch p.giveUp {
+	case giveUpExit, giveUpStop:
+	case giveUpHook:
+		if p.hook == "" {
+			return nil, fmt.Errorf("restart.giveUp is %s but restart.hook is empty", giveUpHook)
+		}
+	default:
+		return nil, fmt.Errorf("unknown restart.giveUp action %q, use %s, %s or %s", p.giveUp, giveUpExit, giveUpStop, giveUpHook)
+	}
+
+	return &p, nil
+}
+
+// crashed records a crash. It returns the delay before the next start, or
+// false if the crash limit is reached.
+func (p *restartPolicy) crashed(exit serverExit) (time.Duration, bool) {
+	// The server ran fine for a while, this is not the same crash again
+	if p.stableUptime > 0 && exit.uptime >= p.stableUptime {
+		p.crashes = 0
+	}
+	p.crashes++
+
+	if p.crashLimit > 0 && p.crashes >= p.crashLimit {
+		return 0, false
+	}
+
+	delay := float64(p.initialDelay)
+	for i := 1; i < p.crashes; i++ {
+		delay *= p.multiplier
+		if delay >= float64(p.maxDelay) {
+			break
+		}
+	}
+	if delay > float64(p.maxDelay) {
+		delay = float64(p.maxDelay)
+	}
+
+	return time.Duration(delay), true
+}
+
+// runGiveUp carries out the give up action. An error means the starter
+// should exit unsuccessfully.
+func (p *restartPolicy) runGiveUp(exit serverExit) error {
+	switch p.giveUp {
+	case giveUpStop:
+		log.Errorf("Server crashed %d times in a row, leaving it stopped until the starter is stopped", p.crashes)
+		return nil
+	case giveUpHook:
+		log.Errorf("Server crashed %d times in a row, running give up hook", p.crashes)
+		err := p.runHook(exit)
+		if err != nil {
+			log.Errorf("Give up hook failed: %v", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("server crashed %d times in a row, giving up", p.crashes)
+}
+
+// staysStopped tells if the starter keeps running without a server after
+// giving up. Exiting would make supervisors like systemd or docker start it
+// again right away.
+func (p *restartPolicy) staysStopped() bool {
+	return p.giveUp == giveUpStop
+}
+
+// The hook gets details about the last crash in its environment
+func (p *restartPolicy) runHook(exit serverExit) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", p.hook)
+	} else {
+		cmd = exec.Command("sh", "-c", p.hook)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"SERVERSTARTER_CRASHES="+strconv.Itoa(p.crashes),
+		"SERVERSTARTER_EXIT_KIND="+exit.kind.String(),
+		"SERVERSTARTER_EXIT_CODE="+strconv.Itoa(exit.code),
+		"SERVERSTARTER_EXIT_REASON="+exit.reason,
+	)
+
+	return cmd.Run()
+}
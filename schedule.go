@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Strange-Account/go-mc-server-starter/config"
+	"github.com/Strange-Account/go-mc-server-starter/cron"
+	"github.com/Strange-Account/go-mc-server-starter/utils"
+)
+
+const (
+	scheduleCommand   = "command"
+	scheduleBroadcast = "broadcast"
+	scheduleRestart   = "restart"
+	scheduleBackup    = "backup"
+)
+
+const (
+	defaultRestartMessage = "Server restarts in {{@time@}}"
+	defaultWorldBackups   = "world-backups"
+	worldBackupTimeFormat = "2006-01-02_15-04-05"
+)
+
+var defaultRestartWarnings = []time.Duration{5 * time.Minute, time.Minute, 10 * time.Second}
+
+// scheduledTask is an entry of launch.schedule
+type scheduledTask struct {
+	config   config.ScheduleConfig
+	schedule *cron.Schedule
+	// Restart warnings, longest first
+	warnings []time.Duration
+}
+
+// parseSchedule checks launch.schedule, so mistakes show up at the start
+// and not in the middle of the night
+func parseSchedule(entries []config.ScheduleConfig) ([]*scheduledTask, error) {
+	var tasks []*scheduledTask
+	for i, entry := range entries {
+		schedule, err := cron.Parse(entry.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("schedule entry %d: %v", i+1, err)
+		}
+		t := scheduledTask{config: entry, schedule: schedule}
+
+		switch entry.Action {
+		case scheduleCommand:
+			if entry.Command == "" {
+				return nil, fmt.Errorf("schedule entry %d: the command action needs a command", i+1)
+			}
+		case scheduleBroadcast:
+			if entry.Message == "" {
+				return nil, fmt.Errorf("schedule entry %d: the broadcast action needs a message", i+1)
+			}
+		case scheduleRestart:
+			t.warnings = defaultRestartWarnings
+			if entry.Warnings != nil {
+				t.warnings = nil
+			}
+			for _, w := range entry.Warnings {
+				d, err := time.ParseDuration(w)
+				if err != nil {
+					return nil, fmt.Errorf("schedule entry %d: %v", i+1, err)
+				}
+				t.warnings = append(t.warnings, d)
+			}
+			sort.Slice(t.warnings, func(a, b int) bool {
+				return t.warnings[a] > t.warnings[b]
+			})
+		case scheduleBackup:
+		default:
+			return nil, fmt.Errorf("schedule entry %d: unknown action %q, use %s, %s, %s or %s", i+1, entry.Action,
+				scheduleCommand, scheduleBroadcast, scheduleRestart, scheduleBackup)
+		}
+
+		tasks = append(tasks, &t)
+	}
+	return tasks, nil
+}
+
+// startSchedule runs the tasks until the returned function is called or a
+// stop is requested
+func (l *loaderManager) startSchedule(tasks []*scheduledTask) func() {
+	done := make(chan struct{})
+	for _, t := range tasks {
+		go l.runScheduledTask(t, done)
+	}
+	return func() {
+		close(done)
+	}
+}
+
+func (l *loaderManager) runScheduledTask(t *scheduledTask, done chan struct{}) {
+	for {
+		next := t.schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Warnf("Schedule %q never runs", t.config.Cron)
+			return
+		}
+		log.Debugf("Next scheduled %s at %s", t.config.Action, next.Format(time.RFC1123))
+
+		// Restarts start warning ahead of time, so they happen on schedule
+		start := next
+		if len(t.warnings) > 0 {
+			start = next.Add(-t.warnings[0])
+		}
+		if !l.sleepUntil(start, done) {
+			return
+		}
+
+		if !l.console.Running() {
+			log.Warnf("Skipping scheduled %s, the server is not running", t.config.Action)
+			if !l.sleepUntil(next, done) {
+				return
+			}
+			continue
+		}
+
+		var err error
+		switch t.config.Action {
+		case scheduleCommand:
+			log.Infof("Running scheduled command %s", t.config.Command)
+			err = l.console.Send(t.config.Command)
+		case scheduleBroadcast:
+			err = l.console.Send("say " + t.config.Message)
+		case scheduleRestart:
+			err = l.scheduledRestart(t, next, done)
+		case scheduleBackup:
+			err = l.backupWorld(t.config)
+		}
+		if err != nil {
+			log.Errorf("Scheduled %s failed: %v", t.config.Action, err)
+		}
+
+		// Never run twice in the same minute
+		if !l.sleepUntil(next, done) {
+			return
+		}
+	}
+}
+
+// sleepUntil returns false if the schedule was stopped in the meantime
+func (l *loaderManager) sleepUntil(t time.Time, done chan struct{}) bool {
+	select {
+	case <-time.After(time.Until(t)):
+		return true
+	case <-done:
+		return false
+	case <-l.stopCh:
+		return false
+	}
+}
+
+// scheduledRestart warns the players and restarts the server at the given
+// time. Warnings already past when it starts are left out.
+func (l *loaderManager) scheduledRestart(t *scheduledTask, at time.Time, done chan struct{}) error {
+	message := t.config.Message
+	if message == "" {
+		message = defaultRestartMessage
+	}
+
+	for _, warning := range t.warnings {
+		warnAt := at.Add(-warning)
+		if time.Until(warnAt) < -time.Second {
+			continue
+		}
+		if !l.sleepUntil(warnAt, done) {
+			return nil
+		}
+		text := strings.ReplaceAll(message, "{{@time@}}", countdownText(warning))
+		log.Infof("Scheduled restart in %s", warning)
+		err := l.console.Send("say " + text)
+		if err != nil {
+			return err
+		}
+	}
+	if !l.sleepUntil(at, done) {
+		return nil
+	}
+
+	log.Info("Restarting the server as scheduled")
+	l.requestRestart()
+	return nil
+}
+
+// countdownText turns 5m into "5 minutes" for the players
+func countdownText(d time.Duration) string {
+	unit := "second"
+	n := int64(d / time.Second)
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		unit = "hour"
+		n = int64(d / time.Hour)
+	case d >= time.Minute && d%time.Minute == 0:
+		unit = "minute"
+		n = int64(d / time.Minute)
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
+
+// Folders Bukkit and Paper keep the other dimensions of a world in
+var dimensionSuffixes = []string{"_nether", "_the_end"}
+
+// backupWorld zips the world and the dimension folders of Bukkit next to it
+// while saving is paused, and drops old world backups. Without a pause there
+// is no backup, the copy could be torn.
+func (l *loaderManager) backupWorld(cfg config.ScheduleConfig) error {
+	properties, err := utils.ReadProperties(filepath.Join(l.basePath, "server.properties"))
+	if err != nil {
+		return err
+	}
+	level := properties.GetDefault("level-name", "world")
+
+	// On the ram disk the world is a symlink
+	worldPath, err := filepath.EvalSymlinks(filepath.Join(l.basePath, level))
+	if err != nil {
+		return err
+	}
+	worlds := []string{worldPath}
+	for _, suffix := range dimensionSuffixes {
+		dimension := filepath.Join(l.basePath, level+suffix)
+		if info, err := os.Stat(dimension); err == nil && info.IsDir() {
+			worlds = append(worlds, dimension)
+		}
+	}
+
+	dir := cfg.Path
+	if dir == "" {
+		dir = defaultWorldBackups
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(l.basePath, dir)
+	}
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	dest := filepath.Join(dir, level+"-"+time.Now().Format(worldBackupTimeFormat)+".zip")
+	err = l.withSavingPaused(func() error {
+		return utils.ZipDirs(worlds, dest)
+	})
+	if err != nil {
+		os.Remove(dest)
+		return err
+	}
+
+	return pruneWorldBackups(dir, level, cfg.Keep)
+}
+
+func pruneWorldBackups(dir string, level string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// The timestamps sort by age, ReadDir sorts by name
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, level+"-") || filepath.Ext(name) != ".zip" {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, level+"-"), ".zip")
+		if _, err := time.Parse(worldBackupTimeFormat, stamp); err != nil {
+			continue
+		}
+		backups = append(backups, name)
+	}
+
+	for len(backups) > keep {
+		log.Infof("Removing old world backup %s", backups[0])
+		err = os.Remove(filepath.Join(dir, backups[0]))
+		if err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"io"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Strange-Account/go-mc-server-starter/console"
+	log "github.com/sirupsen/logrus"
+)
+
+// serverProcess is a running Minecraft server. Its stdin and output are
+// connected to the console, so the starter can send commands itself.
+type serverProcess struct {
+	cmd     *exec.Cmd
+	console *console.Console
+	output  *io.PipeWriter
+	pumped  chan struct{}
+	done    chan struct{}
+	ready   chan struct{}
+
+	mutex         sync.Mutex
+	startTime     time.Time
+	readyTime     time.Time
+	readyTimedOut bool
+	hung          bool
+	stopSeen      bool
+	oomSeen       bool
+	stopping      bool
+	shutdownOnce  sync.Once
+}
+
+func startServerProcess(cmd *exec.Cmd, c *console.Console) (*serverProcess, error) {
+	s := serverProcess{}
+	s.cmd = cmd
+	s.console = c
+	s.pumped = make(chan struct{})
+	s.done = make(chan struct{})
+	s.ready = make(chan struct{})
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	outputReader, outputWriter := io.Pipe()
+	s.output = outputWriter
+	cmd.Stdout = outputWriter
+	cmd.Stderr = outputWriter
+
+	// Signals from the terminal should only reach the starter, it stops
+	// the server itself
+	setProcessGroup(cmd)
+
+	s.startTime = time.Now()
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	c.Attach(stdin)
+	go func() {
+		defer close(s.pumped)
+		c.Pump(outputReader)
+	}()
+
+	return &s, nil
+}
+
+// wait blocks until the server exited and all output was read
+func (s *serverProcess) wait() error {
+	err := s.cmd.Wait()
+	s.console.Detach()
+	s.output.Close()
+	<-s.pumped
+	close(s.done)
+	return err
+}
+
+func (s *serverProcess) waitTimeout(timeout time.Duration) bool {
+	select {
+	case <-s.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (s *serverProcess) exited() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// markReady records the server reached readiness and returns the startup duration
+func (s *serverProcess) markReady() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.readyTime = time.Now()
+	close(s.ready)
+	return s.readyTime.Sub(s.startTime)
+}
+
+func (s *serverProcess) markReadyTimeout() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.readyTimedOut = true
+}
+
+func (s *serverProcess) markHung() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.hung = true
+}
+
+func (s *serverProcess) markStopSeen() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stopSeen = true
+}
+
+func (s *serverProcess) markOutOfMemory() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.oomSeen = true
+}
+
+func (s *serverProcess) isReady() bool {
+	select {
+	case <-s.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendCommand writes a command to the server console
+func (s *serverProcess) sendCommand(command string) error {
+	return s.console.Send(command)
+}
+
+// shutdown saves the world and stops the server through its console. Only if
+// that does not work in time, the server gets SIGTERM and finally SIGKILL.
+// Concurrent calls wait for the first one to finish.
+func (s *serverProcess) shutdown(timeout time.Duration, killTimeout time.Duration) {
+	s.shutdownOnce.Do(func() {
+		s.doShutdown(timeout, killTimeout)
+	})
+}
+
+func (s *serverProcess) doShutdown(timeout time.Duration, killTimeout time.Duration) {
+	if s.exited() {
+		return
+	}
+
+	s.mutex.Lock()
+	s.stopping = true
+	s.mutex.Unlock()
+
+	log.Info("Saving world and stopping server through the console")
+	err := s.sendCommand("save-all")
+	if err == nil {
+		err = s.sendCommand("stop")
+	}
+	if err != nil {
+		log.Warnf("Could not send stop command: %v", err)
+	} else {
+		log.Infof("Waiting up to %s for the server to stop", timeout)
+		if s.waitTimeout(timeout) {
+			log.Info("Server stopped")
+			return
+		}
+		log.Warnf("Server did not stop within %s", timeout)
+	}
+
+	log.Warn("Sending SIGTERM to server")
+	err = s.cmd.Process.Signal(syscall.SIGTERM)
+	if err != nil {
+		log.Warnf("Could not send SIGTERM: %v", err)
+	} else if s.waitTimeout(killTimeout) {
+		log.Info("Server stopped after SIGTERM")
+		return
+	}
+
+	log.Warnf("Server did not stop within %s after SIGTERM, killing it", killTimeout)
+	err = s.cmd.Process.Kill()
+	if err != nil {
+		log.Error(err)
+	}
+	<-s.done
+	log.Info("Server killed")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Strange-Account/go-mc-server-starter/utils"
+)
+
+// expandEnv replaces $VAR and ${VAR} with environment variables.
+// ${VAR:-default} falls back to default if VAR is empty, $$ is a plain $.
+func expandEnv(value string) string {
+	return os.Expand(value, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		if i := strings.Index(name, ":-"); i >= 0 {
+			if v := os.Getenv(name[:i]); v != "" {
+				return v
+			}
+			return name[i+2:]
+		}
+		return os.Getenv(name)
+	})
+}
+
+// applyServerProperties merges launch.serverProperties into
+// server.properties. Comments and keys not in the config stay as they are.
+func (l *loaderManager) applyServerProperties() error {
+	if len(l.launchConfig.ServerProperties) == 0 {
+		return nil
+	}
+
+	propertiesFile := filepath.Join(l.basePath, "server.properties")
+	properties, err := utils.ReadProperties(propertiesFile)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for key := range l.launchConfig.ServerProperties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	changed := false
+	for _, key := range keys {
+		value := expandEnv(l.launchConfig.ServerProperties[key])
+		if current, ok := properties.Get(key); ok && current == value {
+			continue
+		}
+		log.Debugf("Setting %s in server.properties", key)
+		properties.Set(key, value)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	log.Info("Updating server.properties from the config")
+	return properties.Write(propertiesFile)
+}
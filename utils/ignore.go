@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gobwas/glob"
+	log "github.com/sirupsen/logrus"
+)
+
+const regexpPrefix = "re:"
+
+// Parts of regular expressions that mean something else or nothing in a
+// glob, a sign of a rule written for the old regex matching of mods
+var regexpHints = []string{".*", ".+", "\\", "(", ")", "+", "^", "$", "|"}
+
+// IgnoreMatcher decides which files an install skips. Every rule is matched
+// against the destination path relative to the install directory, using
+// forward slashes. Rules are globs, rules starting with "re:" are regular
+// expressions. Both have to match the whole path.
+type IgnoreMatcher struct {
+	rules   []ignoreRule
+	skipped []SkippedFile
+}
+
+type ignoreRule struct {
+	pattern string
+	glob    glob.Glob
+	regexp  *regexp.Regexp
+}
+
+// SkippedFile records which rule skipped which file
+type SkippedFile struct {
+	Path string
+	Rule string
+}
+
+func NewIgnoreMatcher(patterns []string) (*IgnoreMatcher, error) {
+	m := IgnoreMatcher{}
+
+	for _, pattern := range patterns {
+		rule := ignoreRule{pattern: pattern}
+		if strings.HasPrefix(pattern, regexpPrefix) {
+			r, err := regexp.Compile("^(?:" + pattern[len(regexpPrefix):] + ")$")
+			if err != nil {
+				return nil, err
+			}
+			rule.regexp = r
+		} else {
+			warnRegexpLike(pattern)
+			g, err := glob.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			rule.glob = g
+		}
+		m.rules = append(m.rules, rule)
+	}
+
+	return &m, nil
+}
+
+// Rules for mods used to be regular expressions matched against the file
+// name, they are globs on the destination path now
+func warnRegexpLike(pattern string) {
+	if !strings.HasPrefix(pattern, "mods/") {
+		return
+	}
+	for _, hint := range regexpHints {
+		if strings.Contains(pattern, hint) {
+			log.Warnf("ignoreFiles rule %q looks like a regular expression. Rules are globs matched "+
+				"against the install path like mods/optifine*.jar, prefix it with %s to keep it a regular expression matching the whole path.",
+				pattern, regexpPrefix)
+			return
+		}
+	}
+}
+
+// Match returns the first rule matching dest
+func (m *IgnoreMatcher) Match(dest string) (string, bool) {
+	dest = filepath.ToSlash(filepath.Clean(dest))
+
+	for _, rule := range m.rules {
+		if rule.regexp != nil && rule.regexp.MatchString(dest) {
+			return rule.pattern, true
+		}
+		if rule.glob != nil && rule.glob.Match(dest) {
+			return rule.pattern, true
+		}
+	}
+	return "", false
+}
+
+// Skip checks dest and remembers it for the report if it is ignored
+func (m *IgnoreMatcher) Skip(dest string) bool {
+	rule, ok := m.Match(dest)
+	if ok {
+		log.Infof("Skipping file %s (ignoreFiles: %s)", dest, rule)
+		m.skipped = append(m.skipped, SkippedFile{Path: filepath.ToSlash(dest), Rule: rule})
+	}
+	return ok
+}
+
+func (m *IgnoreMatcher) Skipped() []SkippedFile {
+	return m.skipped
+}
+
+// Report logs every skipped file grouped by rule
+func (m *IgnoreMatcher) Report() {
+	if len(m.skipped) == 0 {
+		return
+	}
+
+	log.Infof("Skipped %d files because of ignoreFiles:", len(m.skipped))
+	for _, rule := range m.rules {
+		for _, s := range m.skipped {
+			if s.Rule == rule.pattern {
+				log.Infof("  %s -> %s", rule.pattern, s.Path)
+			}
+		}
+	}
+}
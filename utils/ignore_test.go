@@ -0,0 +1,34 @@
+package utils
+
+import "testing"
+
+func TestIgnoreMatcher(t *testing.T) {
+	m, err := NewIgnoreMatcher([]string{
+		"mods/optifine*.jar",
+		"re:mods/jei.*",
+		"config/*.toml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"mods/optifine-1.12.jar", true},
+		{"mods/sub/optifine.jar", false},
+		{"mods/jei-1.20.jar", true},
+		// Rules match the whole path, not a part of it
+		{"config/mods/jei.cfg", false},
+		{"mods/jei", true},
+		{"other/mods/jei.jar", false},
+		{"config/a.toml", true},
+		{"config/a.cfg", false},
+	}
+	for _, test := range tests {
+		if _, ignored := m.Match(test.path); ignored != test.ignored {
+			t.Errorf("%s: got ignored %v, want %v", test.path, ignored, test.ignored)
+		}
+	}
+}
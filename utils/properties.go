@@ -0,0 +1,241 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Properties is a Java properties file like server.properties. Comments,
+// order and keys that are never touched are written back unchanged.
+type Properties struct {
+	lines []propertyLine
+}
+
+type propertyLine struct {
+	raw   string
+	key   string
+	value string
+	isSet bool
+}
+
+// ReadProperties reads a properties file, a missing file gives empty Properties
+func ReadProperties(path string) (*Properties, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &Properties{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseProperties(f)
+}
+
+func ParseProperties(r io.Reader) (*Properties, error) {
+	p := Properties{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := propertyLine{raw: raw}
+
+		trimmed := strings.TrimLeft(raw, " \t\f")
+		if trimmed != "" && trimmed[0] != '#' && trimmed[0] != '!' {
+			key, value := splitProperty(trimmed)
+			line.key = key
+			line.value = value
+			line.isSet = true
+		}
+
+		p.lines = append(p.lines, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Split at the first unescaped separator
+func splitProperty(line string) (string, string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=', ':':
+			return unescapeProperty(strings.TrimRight(line[:i], " \t\f")), unescapeProperty(strings.TrimLeft(line[i+1:], " \t\f"))
+		case ' ', '\t', '\f':
+			rest := strings.TrimLeft(line[i:], " \t\f")
+			if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+				rest = strings.TrimLeft(rest[1:], " \t\f")
+			}
+			return unescapeProperty(line[:i]), unescapeProperty(rest)
+		}
+	}
+	return unescapeProperty(line), ""
+}
+
+func unescapeProperty(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if r, ok := parseUnicodeEscape(s, i+1); ok {
+				i += 4
+				// Runes outside the BMP are written as UTF-16 surrogate pairs
+				if utf16.IsSurrogate(r) && i+2 < len(s) && s[i+1] == '\\' && s[i+2] == 'u' {
+					if low, ok := parseUnicodeEscape(s, i+3); ok {
+						if pair := utf16.DecodeRune(r, low); pair != unicode.ReplacementChar {
+							r = pair
+							i += 6
+						}
+					}
+				}
+				b.WriteRune(r)
+				continue
+			}
+			b.WriteByte('u')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// parseUnicodeEscape reads the four hex digits of a \u escape at start
+func parseUnicodeEscape(s string, start int) (rune, bool) {
+	if start+4 > len(s) {
+		return 0, false
+	}
+	r, err := strconv.ParseUint(s[start:start+4], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return rune(r), true
+}
+
+func escapeProperty(s string, isKey bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == ' ' && (isKey || i == 0):
+			b.WriteString("\\ ")
+		case r == '\\':
+			b.WriteString("\\\\")
+		case r == '\t':
+			b.WriteString("\\t")
+		case r == '\n':
+			b.WriteString("\\n")
+		case r == '\r':
+			b.WriteString("\\r")
+		case r == '\f':
+			b.WriteString("\\f")
+		case r == '=' || r == ':' || r == '#' || r == '!':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r > 0xffff:
+			r1, r2 := utf16.EncodeRune(r)
+			fmt.Fprintf(&b, "\\u%04X\\u%04X", r1, r2)
+		case r < 0x20 || r > 0x7e:
+			fmt.Fprintf(&b, "\\u%04X", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (p *Properties) Get(key string) (string, bool) {
+	for i := len(p.lines) - 1; i >= 0; i-- {
+		if p.lines[i].isSet && p.lines[i].key == key {
+			return p.lines[i].value, true
+		}
+	}
+	return "", false
+}
+
+// GetDefault returns the value of key or def if it is not set
+func (p *Properties) GetDefault(key string, def string) string {
+	if value, ok := p.Get(key); ok {
+		return value
+	}
+	return def
+}
+
+// Set changes the value of key in place, new keys are appended
+func (p *Properties) Set(key string, value string) {
+	raw := escapeProperty(key, true) + "=" + escapeProperty(value, false)
+
+	for i := len(p.lines) - 1; i >= 0; i-- {
+		if p.lines[i].isSet && p.lines[i].key == key {
+			if p.lines[i].value != value {
+				p.lines[i].raw = raw
+				p.lines[i].value = value
+			}
+			return
+		}
+	}
+
+	p.lines = append(p.lines, propertyLine{raw: raw, key: key, value: value, isSet: true})
+}
+
+// Keys returns all set keys in file order
+func (p *Properties) Keys() []string {
+	var keys []string
+	for _, line := range p.lines {
+		if line.isSet {
+			keys = append(keys, line.key)
+		}
+	}
+	return keys
+}
+
+// AddComment appends a comment line
+func (p *Properties) AddComment(comment string) {
+	p.lines = append(p.lines, propertyLine{raw: "#" + comment})
+}
+
+func (p *Properties) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for _, line := range p.lines {
+		m, err := fmt.Fprintln(w, line.raw)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (p *Properties) Write(path string) error {
+	var b strings.Builder
+	p.WriteTo(&b)
+	return ioutil.WriteFile(path, []byte(b.String()), 0644)
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPropertiesRoundtrip(t *testing.T) {
+	values := map[string]string{
+		"motd":        "Welcome 😀 to the §6server",
+		"level-name":  "Grüße",
+		"plain":       "a=b:c#d!e",
+		"whitespace":  " leading\ttab\nnewline",
+		"emoji-pairs": "🎉🎉",
+	}
+
+	p := &Properties{}
+	for key, value := range values {
+		p.Set(key, value)
+	}
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), `motd=Welcome \uD83D\uDE00 to the \u00A76server`) {
+		t.Errorf("emoji not written as a surrogate pair:\n%s", buf.String())
+	}
+
+	read, err := ParseProperties(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range values {
+		if got, _ := read.Get(key); got != value {
+			t.Errorf("%s: got %q, want %q", key, got, value)
+		}
+	}
+}
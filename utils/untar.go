@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Untar extracts the gzipped tar archive src into dest, keeping file modes
+// and symlinks
+func Untar(src string, dest string) error {
+
+	log.Infof("Extracting %s to %s", src, dest)
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	r := tar.NewReader(gz)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		fpath := filepath.Join(dest, header.Name)
+		if fpath == filepath.Clean(dest) {
+			continue
+		}
+
+		// Same check as for ZipSlip
+		if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("%s: illegal file path", fpath)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(fpath, os.ModePerm)
+		case tar.TypeSymlink:
+			err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm)
+			if err == nil {
+				err = os.Symlink(header.Linkname, fpath)
+			}
+		case tar.TypeReg:
+			err = extractTarFile(r, fpath, os.FileMode(header.Mode))
+		default:
+			log.Debugf("Skipping %s in %s", header.Name, src)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractTarFile(r io.Reader, fpath string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, r)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
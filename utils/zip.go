@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Zip packs the directory src into the zip file dest
+func Zip(src string, dest string) error {
+
+	log.Infof("Zipping %s to %s", src, dest)
+
+	return zipDirs(dest, []string{src}, []string{""})
+}
+
+// ZipDirs packs several directories into the zip file dest, each one in a
+// folder named after it
+func ZipDirs(srcs []string, dest string) error {
+
+	log.Infof("Zipping %s to %s", strings.Join(srcs, ", "), dest)
+
+	var prefixes []string
+	for _, src := range srcs {
+		prefixes = append(prefixes, filepath.Base(src))
+	}
+	return zipDirs(dest, srcs, prefixes)
+}
+
+func zipDirs(dest string, srcs []string, prefixes []string) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := zip.NewWriter(out)
+
+	for i, src := range srcs {
+		err = zipDir(w, src, prefixes[i])
+		if err != nil {
+			w.Close()
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+func zipDir(w *zip.Writer, src string, prefix string) error {
+	return filepath.Walk(src,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == src {
+				return nil
+			}
+
+			name, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+			name = filepath.Join(prefix, name)
+
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			header.Name = filepath.ToSlash(name)
+
+			if info.IsDir() {
+				header.Name += "/"
+				_, err = w.CreateHeader(header)
+				return err
+			}
+
+			header.Method = zip.Deflate
+			writer, err := w.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			_, err = io.Copy(writer, f)
+			return err
+		})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/Strange-Account/go-mc-server-starter/ping"
+	"github.com/Strange-Account/go-mc-server-starter/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Address the watchdog pings, taken from server.properties
+func (l *loaderManager) watchdogAddress() string {
+	if l.launchConfig.Watchdog.Address != "" {
+		return l.launchConfig.Watchdog.Address
+	}
+
+	properties, err := utils.ReadProperties(filepath.Join(l.basePath, "server.properties"))
+	if err != nil {
+		log.Error(err)
+		properties = &utils.Properties{}
+	}
+
+	host := properties.GetDefault("server-ip", "")
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, properties.GetDefault("server-port", "25565"))
+}
+
+// watchHang pings the server once it is ready. A server stuck in a tick loop
+// keeps its process alive but stops answering, after too many failed pings
+// a thread dump is taken and the server is stopped, so it gets restarted.
+func (l *loaderManager) watchHang(server *serverProcess) {
+	select {
+	case <-server.ready:
+	case <-server.done:
+		return
+	}
+
+	address := l.watchdogAddress()
+	maxFailures := l.launchConfig.Watchdog.MaxFailures
+	log.Infof("Watchdog pings %s every %s", address, l.watchdogInterval)
+
+	ticker := time.NewTicker(l.watchdogInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ticker.C:
+		case <-server.done:
+			return
+		}
+
+		status, err := ping.Ping(address, l.watchdogTimeout)
+		if err == nil {
+			if failures > 0 {
+				log.Infof("Server answers pings again")
+			}
+			failures = 0
+			log.Debugf("Watchdog ping: %d/%d players, %s", status.Players.Online, status.Players.Max, status.Latency)
+			continue
+		}
+
+		failures++
+		log.Warnf("Server did not answer ping (%d/%d): %v", failures, maxFailures, err)
+		if failures < maxFailures {
+			continue
+		}
+
+		log.Errorf("Server does not answer anymore, it seems to hang")
+		server.markHung()
+		l.threadDump(server)
+		server.shutdown(l.shutdownTimeout, l.killTimeout)
+		return
+	}
+}
+
+// Write a thread dump of the server with jstack, or let the JVM print one
+// to the console with SIGQUIT if jstack is not available
+func (l *loaderManager) threadDump(server *serverProcess) {
+	pid := server.cmd.Process.Pid
+
+	// The server may be started through a wrapper, jstack belongs to java
+	jstack := "jstack"
+	if java, err := exec.LookPath(l.javaPath()); err == nil {
+		jstack = filepath.Join(filepath.Dir(java), "jstack")
+	}
+	if _, err := os.Stat(jstack); err != nil {
+		jstack, err = exec.LookPath("jstack")
+		if err != nil {
+			jstack = ""
+		}
+	}
+
+	if jstack != "" {
+		dumpDir := filepath.Join(l.basePath, "thread-dumps")
+		dumpFile := filepath.Join(dumpDir, fmt.Sprintf("threaddump-%s.txt", time.Now().Format("2006-01-02_15-04-05")))
+		err := os.MkdirAll(dumpDir, os.ModePerm)
+		if err == nil {
+			var out []byte
+			out, err = exec.Command(jstack, "-l", fmt.Sprint(pid)).CombinedOutput()
+			if err == nil {
+				err = ioutil.WriteFile(dumpFile, out, 0644)
+			}
+		}
+		if err == nil {
+			log.Infof("Thread dump written to %s", dumpFile)
+			return
+		}
+		log.Warnf("jstack failed: %v", err)
+	}
+
+	log.Info("Sending SIGQUIT to the server for a thread dump in the console")
+	err := server.cmd.Process.Signal(syscall.SIGQUIT)
+	if err != nil {
+		log.Errorf("Could not take a thread dump: %v", err)
+		return
+	}
+	// Give the JVM time to print the dump
+	time.Sleep(2 * time.Second)
+}